@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/reconquest/karma-go"
+)
+
+// envToken is a name of environment variable with token which is sent as
+// bearer token to hosts from manul.token-hosts that require authentication.
+const envToken = "MANUL_TOKEN"
+
+type credentials struct {
+	Login    string
+	Password string
+	Token    string
+}
+
+// askpassCredentials caches credentials returned by GIT_ASKPASS program, so
+// user is not asked twice about the same host.
+var askpassCredentials = struct {
+	sync.Mutex
+	hosts map[string]credentials
+}{hosts: map[string]credentials{}}
+
+// httpGet requests given URL using credentials from .netrc. If server
+// responds with 401 Unauthorized, request is repeated with token from
+// MANUL_TOKEN if host is listed in manul.token-hosts or with credentials
+// asked from GIT_ASKPASS program.
+func httpGet(target string) (*http.Response, error) {
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return nil, karma.Format(err, "invalid URL: %s", target)
+	}
+
+	host := parsed.Hostname()
+
+	netrc, ok, err := getNetrcCredentials(host)
+	if err != nil {
+		logger.Warning(err)
+	}
+
+	if ok {
+		logger.Tracef("using credentials for %s from .netrc", host)
+	}
+
+	response, err := httpGetWithCredentials(target, netrc)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusUnauthorized {
+		return response, nil
+	}
+
+	token := os.Getenv(envToken)
+	if token != "" && !isTokenHost(host) {
+		logger.Debugf(
+			"not sending %s to %s, it's not listed in manul.token-hosts",
+			envToken, host,
+		)
+
+		token = ""
+	}
+
+	var fallback credentials
+	switch {
+	case token != "":
+		fallback = credentials{Token: token}
+
+	case os.Getenv("GIT_ASKPASS") != "":
+		fallback, err = getAskpassCredentials(parsed)
+		if err != nil {
+			logger.Warning(err)
+			return response, nil
+		}
+
+	default:
+		return response, nil
+	}
+
+	response.Body.Close()
+
+	logger.Debugf("%s requires authentication, retrying with credentials", target)
+
+	return httpGetWithCredentials(target, fallback)
+}
+
+// isTokenHost reports whether MANUL_TOKEN can be sent to given host. Any
+// server which serves go-import meta can respond with 401, so the token is
+// sent only to hosts which user trusts explicitly.
+func isTokenHost(host string) bool {
+	for _, item := range tokenHosts {
+		if item == host {
+			return true
+		}
+	}
+
+	return false
+}
+
+func httpGetWithCredentials(
+	target string,
+	auth credentials,
+) (*http.Response, error) {
+	request, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		return nil, karma.Format(err, "unable to create request to %s", target)
+	}
+
+	switch {
+	case auth.Token != "":
+		request.Header.Set("Authorization", "Bearer "+auth.Token)
+	case auth.Login != "" || auth.Password != "":
+		request.SetBasicAuth(auth.Login, auth.Password)
+	}
+
+	return http.DefaultClient.Do(request)
+}
+
+// getNetrcCredentials returns login and password for given host from file
+// specified by NETRC environment variable or ~/.netrc, default entry is used
+// if there is no entry for given host.
+func getNetrcCredentials(host string) (credentials, bool, error) {
+	path := os.Getenv("NETRC")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return credentials{}, false, nil
+		}
+
+		path = filepath.Join(home, ".netrc")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return credentials{}, false, nil
+		}
+
+		return credentials{}, false, karma.Format(
+			err, "unable to open %s", path,
+		)
+	}
+
+	defer file.Close()
+
+	var (
+		scanner  = bufio.NewScanner(file)
+		current  *credentials
+		found    credentials
+		fallback *credentials
+		ok       bool
+	)
+
+	scanner.Split(bufio.ScanWords)
+
+	for scanner.Scan() {
+		switch scanner.Text() {
+		case "machine":
+			if !scanner.Scan() {
+				break
+			}
+
+			current = nil
+			if scanner.Text() == host && !ok {
+				current, ok = &found, true
+			}
+
+		case "default":
+			current = nil
+			if fallback == nil {
+				fallback = &credentials{}
+				current = fallback
+			}
+
+		case "login":
+			if scanner.Scan() && current != nil {
+				current.Login = scanner.Text()
+			}
+
+		case "password":
+			if scanner.Scan() && current != nil {
+				current.Password = scanner.Text()
+			}
+
+		case "macdef":
+			// macro definitions are not supported and terminated by empty
+			// line which is not visible when splitting by words, so stop
+			// parsing here.
+			current = nil
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return credentials{}, false, karma.Format(
+			err, "unable to read %s", path,
+		)
+	}
+
+	if ok {
+		return found, true, nil
+	}
+
+	if fallback != nil {
+		return *fallback, true, nil
+	}
+
+	return credentials{}, false, nil
+}
+
+// getAskpassCredentials asks login and password for given URL using program
+// specified in GIT_ASKPASS the same way as git does.
+func getAskpassCredentials(target *url.URL) (credentials, error) {
+	askpassCredentials.Lock()
+	defer askpassCredentials.Unlock()
+
+	if auth, ok := askpassCredentials.hosts[target.Host]; ok {
+		return auth, nil
+	}
+
+	var (
+		program = os.Getenv("GIT_ASKPASS")
+		remote  = target.Scheme + "://" + target.Host
+		auth    credentials
+		err     error
+	)
+
+	auth.Login, err = askpass(
+		program, fmt.Sprintf("Username for '%s': ", remote),
+	)
+	if err != nil {
+		return auth, err
+	}
+
+	auth.Password, err = askpass(
+		program, fmt.Sprintf("Password for '%s://%s@%s': ",
+			target.Scheme, auth.Login, target.Host,
+		),
+	)
+	if err != nil {
+		return auth, err
+	}
+
+	askpassCredentials.hosts[target.Host] = auth
+
+	return auth, nil
+}
+
+// askpass runs GIT_ASKPASS program directly instead of execute, because
+// output of commands is logged in trace mode.
+func askpass(program string, prompt string) (string, error) {
+	output, err := exec.Command(program, prompt).Output()
+	if err != nil {
+		return "", karma.Format(
+			err, "unable to get credentials using GIT_ASKPASS",
+		)
+	}
+
+	return strings.TrimRight(string(output), "\r\n"), nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/reconquest/karma-go"
+)
+
+const repoRootsCacheFile = "manul/repo-roots.json"
+
+type cachedRepoRoot struct {
+	repoRoot
+	Resolved time.Time
+}
+
+func getRepoRootsCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", karma.Format(
+			err, "unable to get cache directory",
+		)
+	}
+
+	return filepath.Join(dir, repoRootsCacheFile), nil
+}
+
+// loadRepoRootsCache reads repository roots resolved by previous runs,
+// missing or corrupted cache is not an error.
+func loadRepoRootsCache() map[string]cachedRepoRoot {
+	roots := map[string]cachedRepoRoot{}
+
+	path, err := getRepoRootsCachePath()
+	if err != nil {
+		logger.Warning(err)
+		return roots
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warningf("unable to read cache %s: %s", path, err)
+		}
+
+		return roots
+	}
+
+	err = json.Unmarshal(contents, &roots)
+	if err != nil {
+		logger.Warningf("unable to decode cache %s: %s", path, err)
+		return map[string]cachedRepoRoot{}
+	}
+
+	return roots
+}
+
+// saveRepoRootsCache writes resolved repository roots, file is replaced
+// atomically, so concurrent runs of manul don't see partially written cache.
+func saveRepoRootsCache(roots map[string]cachedRepoRoot) error {
+	path, err := getRepoRootsCachePath()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return karma.Format(
+			err, "unable to create cache directory",
+		)
+	}
+
+	contents, err := json.MarshalIndent(roots, "", "    ")
+	if err != nil {
+		return karma.Format(
+			err, "unable to encode cache",
+		)
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(path), ".repo-roots")
+	if err != nil {
+		return karma.Format(
+			err, "unable to create temporary cache file",
+		)
+	}
+
+	_, err = temp.Write(contents)
+	if err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+
+		return karma.Format(
+			err, "unable to write cache %s", temp.Name(),
+		)
+	}
+
+	err = temp.Close()
+	if err != nil {
+		os.Remove(temp.Name())
+
+		return karma.Format(
+			err, "unable to write cache %s", temp.Name(),
+		)
+	}
+
+	err = os.Rename(temp.Name(), path)
+	if err != nil {
+		os.Remove(temp.Name())
+
+		return karma.Format(
+			err, "unable to replace cache %s", path,
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/reconquest/karma-go"
+)
+
+// maxCommitLogLines limits number of upstream commits listed for updated
+// dependency in generated commit message.
+const maxCommitLogLines = 20
+
+// withVendorCommit wraps mutating command, so changes of vendor submodules
+// made by command are committed with generated message when --commit is
+// passed.
+func withVendorCommit(command func() error) func() error {
+	if !autoCommit {
+		return command
+	}
+
+	return func() error {
+		err := ensureVendorFilesClean()
+		if err != nil {
+			return err
+		}
+
+		// submodules which user already moved are compared with their
+		// working tree commits, so they are not committed unless command
+		// changes them
+		before, err := getWorktreeVendorCommits()
+		if err != nil {
+			return err
+		}
+
+		err = command()
+		if err != nil {
+			return err
+		}
+
+		return commitVendorChanges(before)
+	}
+}
+
+// getRecordedVendorCommits returns commits of vendor submodules recorded in
+// index of main repository.
+func getRecordedVendorCommits() (map[string]string, error) {
+	output, err := executeStdout(
+		exec.Command("git", "ls-files", "--stage", "--", vendorDir),
+	)
+	if err != nil {
+		return nil, karma.Format(err, "unable to list vendor submodules")
+	}
+
+	commits := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		// <mode> <object> <stage>\t<path>
+		fields := strings.SplitN(line, "\t", 2)
+		if len(fields) != 2 || !strings.HasPrefix(fields[0], "160000 ") {
+			continue
+		}
+
+		path := strings.TrimPrefix(fields[1], vendorDir+"/")
+		commits[path] = strings.Fields(fields[0])[1]
+	}
+
+	return commits, nil
+}
+
+// getWorktreeVendorCommits returns commits checked out in vendor
+// submodules, recorded commits are used for submodules which are not
+// initialized.
+func getWorktreeVendorCommits() (map[string]string, error) {
+	commits, err := getRecordedVendorCommits()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses, err := getVendorSubmodulesStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	// updated submodules are not staged, so their new commits are taken from
+	// working tree
+	for importpath, status := range statuses {
+		if status.State != '-' {
+			commits[importpath] = status.Commit
+		}
+	}
+
+	return commits, nil
+}
+
+// vendorChange is a change of single vendor submodule, Old is empty for
+// added submodules and New is empty for removed ones.
+type vendorChange struct {
+	Importpath string
+	Old        string
+	New        string
+}
+
+// commitVendorChanges commits .gitmodules, module files and vendor
+// submodules changed since given state. Changes of other files, even
+// staged ones, are not committed.
+func commitVendorChanges(before map[string]string) error {
+	after, err := getWorktreeVendorCommits()
+	if err != nil {
+		return err
+	}
+
+	changes := getVendorChanges(before, after)
+	if len(changes) == 0 {
+		logger.Infof("nothing to commit")
+		return nil
+	}
+
+	paths := []string{}
+	for _, change := range changes {
+		paths = append(paths, getVendorPath(change.Importpath))
+	}
+
+	paths = append(paths, getVendorCommitFiles()...)
+
+	message := formatVendorCommitMessage(changes)
+
+	_, err = executeChange(
+		exec.Command(
+			"git", append([]string{"commit", "-q", "-m", message, "--"}, paths...)...,
+		),
+	)
+	if err != nil {
+		return karma.Format(err, "unable to commit vendor changes")
+	}
+
+	logger.Infof("committed changes of %d vendor submodules", len(changes))
+
+	return nil
+}
+
+// getVendorCommitFiles returns existing files which are changed along with
+// vendor submodules and committed with them.
+func getVendorCommitFiles() []string {
+	var files []string
+	for _, path := range []string{
+		getGitmodulesPath(),
+		filepath.Join(workdir, vendorModulesFile),
+		filepath.Join(workdir, "go.mod"),
+		filepath.Join(workdir, "go.sum"),
+	} {
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+
+	return files
+}
+
+// ensureVendorFilesClean checks that files committed with vendor changes
+// don't contain changes made by user, otherwise they would be committed
+// under generated message too.
+func ensureVendorFilesClean() error {
+	files := getVendorCommitFiles()
+	if len(files) == 0 {
+		return nil
+	}
+
+	output, err := executeStdout(
+		exec.Command(
+			"git", append([]string{"status", "--porcelain", "--"}, files...)...,
+		),
+	)
+	if err != nil {
+		return karma.Format(err, "unable to get status of vendor files")
+	}
+
+	if strings.TrimSpace(output) != "" {
+		return fmt.Errorf(
+			"files committed by --commit have uncommitted changes, "+
+				"commit or stash them first:\n%s",
+			strings.TrimRight(output, "\n"),
+		)
+	}
+
+	return nil
+}
+
+func getVendorChanges(before, after map[string]string) []vendorChange {
+	var changes []vendorChange
+
+	for importpath, commit := range after {
+		if before[importpath] != commit {
+			changes = append(changes, vendorChange{
+				Importpath: importpath,
+				Old:        before[importpath],
+				New:        commit,
+			})
+		}
+	}
+
+	for importpath, commit := range before {
+		if _, ok := after[importpath]; !ok {
+			changes = append(changes, vendorChange{
+				Importpath: importpath,
+				Old:        commit,
+			})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Importpath < changes[j].Importpath
+	})
+
+	return changes
+}
+
+// formatVendorCommitMessage returns commit message like:
+//
+//	vendor: add 1, update 1 dependencies
+//
+//	added:
+//	    github.com/foo/bar 1a2b3c4
+//
+//	updated:
+//	    github.com/foo/baz 5d6e7f8 -> 9a8b7c6
+//	        9a8b7c6 fix something
+func formatVendorCommitMessage(changes []vendorChange) string {
+	var added, updated, removed []string
+
+	for _, change := range changes {
+		switch {
+		case change.Old == "":
+			added = append(
+				added,
+				fmt.Sprintf("    %s %s", change.Importpath, shortCommit(change.New)),
+			)
+
+		case change.New == "":
+			removed = append(
+				removed,
+				fmt.Sprintf("    %s %s", change.Importpath, shortCommit(change.Old)),
+			)
+
+		default:
+			updated = append(
+				updated,
+				fmt.Sprintf(
+					"    %s %s -> %s",
+					change.Importpath,
+					shortCommit(change.Old),
+					shortCommit(change.New),
+				),
+			)
+
+			for _, line := range getUpstreamLog(change) {
+				updated = append(updated, "        "+line)
+			}
+		}
+	}
+
+	var (
+		subject string
+		counts  = map[string]int{}
+	)
+
+	for _, change := range changes {
+		counts[getVendorChangeVerb(change)]++
+	}
+
+	if len(changes) == 1 {
+		subject = fmt.Sprintf(
+			"vendor: %s %s",
+			getVendorChangeVerb(changes[0]), changes[0].Importpath,
+		)
+	} else {
+		var parts []string
+		for _, verb := range []string{"add", "update", "remove"} {
+			if counts[verb] > 0 {
+				parts = append(parts, fmt.Sprintf("%s %d", verb, counts[verb]))
+			}
+		}
+
+		subject = "vendor: " + strings.Join(parts, ", ") + " dependencies"
+	}
+
+	sections := []string{subject}
+	for _, section := range []struct {
+		title string
+		lines []string
+	}{
+		{"added", added},
+		{"updated", updated},
+		{"removed", removed},
+	} {
+		if len(section.lines) > 0 {
+			sections = append(
+				sections,
+				section.title+":\n"+strings.Join(section.lines, "\n"),
+			)
+		}
+	}
+
+	return strings.Join(sections, "\n\n") + "\n"
+}
+
+// getUpstreamLog returns one-line log of commits between old and new
+// commits of updated submodule, nothing is returned if log is not available,
+// e.g. for downgrades.
+func getUpstreamLog(change vendorChange) []string {
+	output, err := executeStdout(
+		exec.Command(
+			"git", "-C", filepath.Join(workdir, getVendorPath(change.Importpath)),
+			"log", "--oneline", "--no-decorate", "--abbrev=7",
+			change.Old+".."+change.New,
+		),
+	)
+	if err != nil {
+		logger.Debugf(
+			"unable to get log of %s: %s", change.Importpath, err,
+		)
+
+		return nil
+	}
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return nil
+	}
+
+	if len(lines) > maxCommitLogLines {
+		more := len(lines) - maxCommitLogLines
+		lines = append(
+			lines[:maxCommitLogLines],
+			fmt.Sprintf("... and %d more commits", more),
+		)
+	}
+
+	return lines
+}
+
+func getVendorChangeVerb(change vendorChange) string {
+	switch {
+	case change.Old == "":
+		return "add"
+	case change.New == "":
+		return "remove"
+	default:
+		return "update"
+	}
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+
+	return commit
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/reconquest/karma-go"
+)
+
+// configFile is a file in git config format which can be checked in into
+// project repository for sharing manul settings, settings can also be
+// specified in [manul] section of git config.
+const configFile = ".manul"
+
+type rewriteRule struct {
+	Prefix string
+	URL    string
+}
+
+// getConfigValues returns all values of manul.<key> from project config file
+// and git config.
+func getConfigValues(key string) ([]string, error) {
+	var values []string
+
+	sources := [][]string{{"config"}}
+
+	_, err := os.Stat(filepath.Join(workdir, configFile))
+	if err == nil {
+		sources = append([][]string{{"config", "-f", configFile}}, sources...)
+	}
+
+	for _, source := range sources {
+		sourceValues, err := readConfigValues(source, key)
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, sourceValues...)
+	}
+
+	return values, nil
+}
+
+// getUserConfigValues returns values of manul.<key> only from git config,
+// settings which concern credentials must not come from project config file
+// which is checked in.
+func getUserConfigValues(key string) ([]string, error) {
+	return readConfigValues([]string{"config"}, key)
+}
+
+func readConfigValues(source []string, key string) ([]string, error) {
+	args := append(source, "--get-all", "manul."+key)
+
+	output, err := execute(exec.Command("git", args...))
+	if err != nil {
+		// git config exits with code 1 without any output if key is not
+		// set.
+		if strings.TrimSpace(output) == "" {
+			return nil, nil
+		}
+
+		return nil, karma.Format(
+			err, "unable to read manul.%s from git config", key,
+		)
+	}
+
+	var values []string
+	for _, value := range strings.Split(output, "\n") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values, nil
+}
+
+// getRewriteRules returns URL rewrite rules specified as
+// manul.rewrite = <import path prefix> <URL prefix>, rules with longer
+// prefixes go first.
+func getRewriteRules() ([]rewriteRule, error) {
+	values, err := getConfigValues("rewrite")
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []rewriteRule
+	for _, value := range values {
+		fields := strings.Fields(strings.Replace(value, "=>", " ", 1))
+		if len(fields) != 2 {
+			return nil, fmt.Errorf(
+				"invalid manul.rewrite rule %q, "+
+					"expected <import path prefix> <URL prefix>",
+				value,
+			)
+		}
+
+		rules = append(rules, rewriteRule{Prefix: fields[0], URL: fields[1]})
+	}
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(rules[i].Prefix) > len(rules[j].Prefix)
+	})
+
+	return rules, nil
+}
+
+// rewriteURL returns URL for repository with given import path according to
+// rewrite rules, second value is false if no rule matches.
+func rewriteURL(rules []rewriteRule, importpath string) (string, bool) {
+	for _, rule := range rules {
+		if strings.HasPrefix(importpath, rule.Prefix) {
+			return rule.URL + strings.TrimPrefix(importpath, rule.Prefix), true
+		}
+	}
+
+	return "", false
+}
+
+// projectConfig contains project-wide defaults, which are specified as
+// manul.<key> in project config file or git config and merged with command
+// line options.
+type projectConfig struct {
+	// Recursive and Testing are defaults for -r and -t flags.
+	Recursive bool
+	Testing   bool
+
+	// Ignore is a list of glob patterns of import paths which are never
+	// vendored, packages of ignored import paths are ignored as well.
+	Ignore []string
+
+	// Pins maps import path to commit-ish which is used by -I and -U when
+	// version is not specified explicitly.
+	Pins map[string]string
+
+	// VendorDir is a directory where submodules are placed.
+	VendorDir string
+
+	// TokenHosts is a list of hosts which MANUL_TOKEN is sent to, it's read
+	// only from git config.
+	TokenHosts []string
+}
+
+func getProjectConfig() (projectConfig, error) {
+	config := projectConfig{
+		Pins:      map[string]string{},
+		VendorDir: "vendor",
+	}
+
+	for key, value := range map[string]*bool{
+		"recursive": &config.Recursive,
+		"testing":   &config.Testing,
+	} {
+		values, err := getConfigValues(key)
+		if err != nil {
+			return config, err
+		}
+
+		if len(values) == 0 {
+			continue
+		}
+
+		// the last value wins as in git config --get
+		*value, err = parseConfigBool(values[len(values)-1])
+		if err != nil {
+			return config, karma.Format(err, "invalid manul.%s", key)
+		}
+	}
+
+	var err error
+	config.Ignore, err = getConfigValues("ignore")
+	if err != nil {
+		return config, err
+	}
+
+	pins, err := getConfigValues("pin")
+	if err != nil {
+		return config, err
+	}
+
+	for _, pin := range pins {
+		fields := strings.Fields(strings.Replace(pin, "=", " ", 1))
+		if len(fields) != 2 {
+			return config, fmt.Errorf(
+				"invalid manul.pin %q, expected <import path>=<commit-ish>",
+				pin,
+			)
+		}
+
+		config.Pins[fields[0]] = fields[1]
+	}
+
+	tokenHosts, err := getUserConfigValues("token-hosts")
+	if err != nil {
+		return config, err
+	}
+
+	for _, hosts := range tokenHosts {
+		config.TokenHosts = append(config.TokenHosts, splitList(hosts)...)
+	}
+
+	vendor, err := getConfigValues("vendor")
+	if err != nil {
+		return config, err
+	}
+
+	if len(vendor) > 0 {
+		value := vendor[len(vendor)-1]
+		dir := filepath.ToSlash(filepath.Clean(value))
+
+		if value == "" || filepath.IsAbs(value) || dir == "." ||
+			dir == ".." || strings.HasPrefix(dir, "../") {
+			return config, fmt.Errorf(
+				"invalid manul.vendor %q, expected relative path "+
+					"inside of project directory",
+				value,
+			)
+		}
+
+		config.VendorDir = dir
+	}
+
+	return config, nil
+}
+
+// parseConfigBool parses boolean value the same way as git config does.
+func parseConfigBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0", "":
+		return false, nil
+	}
+
+	return false, fmt.Errorf("invalid boolean value %q", value)
+}
+
+// isIgnored reports whether given import path or any of its parents matches
+// one of ignore rules, rules are glob patterns where * doesn't match /, so
+// github.com/corp/* ignores all repositories of github.com/corp.
+func isIgnored(ignore []string, importpath string) bool {
+	for _, pattern := range ignore {
+		for path := importpath; path != ""; path = parentPath(path) {
+			matched, err := pathpkg.Match(pattern, path)
+			if err != nil {
+				logger.Warningf("invalid ignore rule %q: %s", pattern, err)
+				break
+			}
+
+			if matched {
+				return true
+			}
+		}
+	}
+
+	return false
+}
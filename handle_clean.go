@@ -27,6 +27,13 @@ func handleClean(recursive, withTests bool) error {
 			continue
 		}
 
+		// ignored dependencies are not managed by manul, so they are
+		// neither used nor unused.
+		if isIgnored(ignoredImports, submodule) {
+			logger.Infof("keeping ignored vendor submodule %s", submodule)
+			continue
+		}
+
 		logger.Infof("removing unused vendor submodule %s", submodule)
 
 		err := removeVendorSubmodule(submodule)
@@ -49,5 +56,5 @@ func handleClean(recursive, withTests bool) error {
 		logger.Infof("nothing to remove")
 	}
 
-	return nil
+	return writeVendorModules()
 }
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/reconquest/karma-go"
+)
+
+const (
+	changeAdded      = "added"
+	changeRemoved    = "removed"
+	changeUpdated    = "updated"
+	changeDowngraded = "downgraded"
+)
+
+// vendorChangelog describes what changed in vendor submodule.
+type vendorChangelog struct {
+	Importpath string `json:"importpath"`
+
+	// Status is one of added, removed, updated and downgraded.
+	Status string `json:"status"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+
+	// Range is a range of upstream commits like old..new, for downgrades
+	// it's new..old and contains commits which are reverted.
+	Range string `json:"range,omitempty"`
+
+	// Commits is a number of commits in Range and Log is one-line log of
+	// them.
+	Commits int      `json:"commits"`
+	Log     []string `json:"log,omitempty"`
+
+	FilesChanged int `json:"files_changed"`
+
+	// Forced is true if neither Old nor New is an ancestor of another one,
+	// which means that upstream history was rewritten or submodule was
+	// moved to another branch.
+	Forced bool `json:"forced"`
+
+	// Unavailable is true if commits are not found in submodule repository,
+	// so nothing except commits themselves is known.
+	Unavailable bool `json:"unavailable,omitempty"`
+}
+
+// handleDiff shows changes of vendor submodules between two revisions of
+// main repository. If only one revision is given, it's compared to working
+// tree, HEAD is used if no revisions are given.
+func handleDiff(revs []string, format string) error {
+	if len(revs) == 0 {
+		revs = []string{"HEAD"}
+	}
+
+	before, err := getTreeVendorCommits(revs[0])
+	if err != nil {
+		return err
+	}
+
+	var after map[string]string
+	if len(revs) > 1 {
+		after, err = getTreeVendorCommits(revs[1])
+	} else {
+		after, err = getWorktreeVendorCommits()
+	}
+	if err != nil {
+		return err
+	}
+
+	changelogs := getVendorChangelogs(getVendorChanges(before, after))
+
+	return printVendorChangelogs(changelogs, format)
+}
+
+// getTreeVendorCommits returns commits of vendor submodules recorded in given
+// revision of main repository.
+func getTreeVendorCommits(rev string) (map[string]string, error) {
+	output, err := executeStdout(
+		exec.Command("git", "ls-tree", "-r", rev, "--", vendorDir),
+	)
+	if err != nil {
+		return nil, karma.Format(
+			err, "unable to list vendor submodules at %s", rev,
+		)
+	}
+
+	commits := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		// <mode> <type> <object>\t<path>
+		fields := strings.SplitN(line, "\t", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		info := strings.Fields(fields[0])
+		if len(info) != 3 || info[1] != "commit" {
+			continue
+		}
+
+		commits[strings.TrimPrefix(fields[1], vendorDir+"/")] = info[2]
+	}
+
+	return commits, nil
+}
+
+func getVendorChangelogs(changes []vendorChange) []vendorChangelog {
+	changelogs := make([]vendorChangelog, len(changes))
+	for i, change := range changes {
+		changelogs[i] = getVendorChangelog(change)
+	}
+
+	return changelogs
+}
+
+// getVendorChangelog inspects history of changed submodule between old and
+// new commits, commits which are missing locally are fetched from origin.
+func getVendorChangelog(change vendorChange) vendorChangelog {
+	changelog := vendorChangelog{
+		Importpath: change.Importpath,
+		Old:        change.Old,
+		New:        change.New,
+	}
+
+	switch {
+	case change.Old == "":
+		changelog.Status = changeAdded
+		return changelog
+
+	case change.New == "":
+		changelog.Status = changeRemoved
+		return changelog
+	}
+
+	changelog.Status = changeUpdated
+	changelog.Range = shortCommit(change.Old) + ".." + shortCommit(change.New)
+
+	// fetching in directory of uninitialized submodule would fetch main
+	// repository
+	if !isVendorSubmoduleInitialized(change.Importpath) {
+		logger.Debugf(
+			"%s is not initialized, its history is not available",
+			change.Importpath,
+		)
+
+		changelog.Unavailable = true
+		return changelog
+	}
+
+	cwd := filepath.Join(workdir, getVendorPath(change.Importpath))
+
+	ahead, err := countCommits(cwd, change.Old, change.New)
+	if err != nil && !offline {
+		logger.Debugf(
+			"fetching missing commits of %s: %s", change.Importpath, err,
+		)
+
+		_, err = execute(exec.Command("git", "-C", cwd, "fetch", "-q", "origin"))
+		if err == nil {
+			ahead, err = countCommits(cwd, change.Old, change.New)
+		}
+	}
+
+	if err != nil {
+		logger.Debugf(
+			"unable to get history of %s: %s", change.Importpath, err,
+		)
+
+		changelog.Unavailable = true
+		return changelog
+	}
+
+	behind, err := countCommits(cwd, change.New, change.Old)
+	if err != nil {
+		changelog.Unavailable = true
+		return changelog
+	}
+
+	logged := change
+	switch {
+	case ahead == 0 && behind > 0:
+		changelog.Status = changeDowngraded
+		changelog.Range = shortCommit(change.New) + ".." + shortCommit(change.Old)
+		changelog.Commits = behind
+
+		logged = vendorChange{
+			Importpath: change.Importpath,
+			Old:        change.New,
+			New:        change.Old,
+		}
+
+	case behind > 0:
+		changelog.Forced = true
+		changelog.Commits = ahead
+
+	default:
+		changelog.Commits = ahead
+	}
+
+	changelog.Log = getUpstreamLog(logged)
+
+	// file names can contain spaces and newlines, so they are separated
+	// by NUL
+	output, err := executeStdout(
+		exec.Command(
+			"git", "-C", cwd, "diff", "--name-only", "-z",
+			change.Old, change.New,
+		),
+	)
+	if err == nil {
+		for _, name := range strings.Split(output, "\x00") {
+			if name != "" {
+				changelog.FilesChanged++
+			}
+		}
+	}
+
+	return changelog
+}
+
+// countCommits returns number of commits which are reachable from to, but
+// not from from.
+func countCommits(cwd string, from string, to string) (int, error) {
+	output, err := execute(
+		exec.Command("git", "-C", cwd, "rev-list", "--count", from+".."+to),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(output))
+}
+
+func printVendorChangelogs(changelogs []vendorChangelog, format string) error {
+	switch format {
+	case formatJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "    ")
+
+		err := encoder.Encode(changelogs)
+		if err != nil {
+			return karma.Format(err, "unable to encode vendor diff")
+		}
+
+	case formatTSV:
+		for _, changelog := range changelogs {
+			fmt.Printf(
+				"%s\t%s\t%s\t%s\t%d\t%d\t%t\n",
+				changelog.Importpath, changelog.Status,
+				changelog.Old, changelog.New,
+				changelog.Commits, changelog.FilesChanged, changelog.Forced,
+			)
+		}
+
+	default:
+		if len(changelogs) == 0 {
+			logger.Infof("vendor submodules are not changed")
+			return nil
+		}
+
+		for _, changelog := range changelogs {
+			fmt.Println(formatVendorChangelog(changelog))
+
+			for _, line := range changelog.Log {
+				fmt.Println("    " + line)
+			}
+		}
+	}
+
+	return nil
+}
+
+func formatVendorChangelog(changelog vendorChangelog) string {
+	importpath := changelog.Importpath
+
+	switch {
+	case changelog.Status == changeAdded:
+		return fmt.Sprintf(
+			"%s added at %s", importpath, shortCommit(changelog.New),
+		)
+
+	case changelog.Status == changeRemoved:
+		return fmt.Sprintf(
+			"%s removed, was at %s", importpath, shortCommit(changelog.Old),
+		)
+
+	case changelog.Unavailable:
+		return fmt.Sprintf(
+			"%s %s (history is not available locally)",
+			importpath, changelog.Range,
+		)
+	}
+
+	files := pluralize(changelog.FilesChanged, "file", "files") + " changed"
+
+	switch {
+	case changelog.Status == changeDowngraded:
+		return fmt.Sprintf(
+			"%s %s..%s (downgraded: %s reverted, %s)",
+			importpath,
+			shortCommit(changelog.Old), shortCommit(changelog.New),
+			pluralize(changelog.Commits, "commit", "commits"), files,
+		)
+
+	case changelog.Forced:
+		return fmt.Sprintf(
+			"%s %s (force-push: %s is not an ancestor of %s, %s, %s)",
+			importpath, changelog.Range,
+			shortCommit(changelog.Old), shortCommit(changelog.New),
+			pluralize(changelog.Commits, "commit", "commits"), files,
+		)
+	}
+
+	return fmt.Sprintf(
+		"%s %s (%s, %s)",
+		importpath, changelog.Range,
+		pluralize(changelog.Commits, "commit", "commits"), files,
+	)
+}
+
+func pluralize(count int, singular, plural string) string {
+	if count == 1 {
+		return "1 " + singular
+	}
+
+	return strconv.Itoa(count) + " " + plural
+}
@@ -8,7 +8,7 @@ import (
 )
 
 func handleInstall(recursive bool, withTests bool,
-	dependencies []string) error {
+	dependencies []string, jobs int) error {
 	imports, err := parseImports(recursive, withTests)
 	if err != nil {
 		return err
@@ -24,7 +24,15 @@ func handleInstall(recursive bool, withTests bool,
 		return err
 	}
 
-	added := 0
+	var modules map[string]moduleInfo
+	if modulePath != "" {
+		modules, err = getModuleGraph()
+		if err != nil {
+			return err
+		}
+	}
+
+	var pending, versions []string
 	for _, dependency := range dependencies {
 		parts := strings.Split(dependency, "=")
 		if len(parts) > 2 {
@@ -37,10 +45,15 @@ func handleInstall(recursive bool, withTests bool,
 		}
 
 		if !installAll {
+			if isIgnored(ignoredImports, dependency) {
+				return fmt.Errorf("dependency %s is ignored", dependency)
+			}
+
 			found := false
 			for _, importpath := range imports {
 				// there is HasPrefix for handling subpackages
-				if strings.HasPrefix(importpath, dependency) {
+				if strings.HasPrefix(importpath, dependency) ||
+					hasPathPrefix(dependency, importpath) {
 					found = true
 					break
 				}
@@ -64,9 +77,82 @@ func handleInstall(recursive bool, withTests bool,
 			continue
 		}
 
+		if version == "" {
+			version = pinnedVersions[dependency]
+		}
+
+		if modulePath != "" {
+			module, ok := modules[dependency]
+			if !ok {
+				return fmt.Errorf(
+					"dependency %s is not a module required by go.mod",
+					dependency,
+				)
+			}
+
+			repo := getRepoImportpath(module.Path)
+			if repo != trimMajorVersion(module.Path) {
+				return fmt.Errorf(
+					"module %s is located in subdirectory of repository %s, "+
+						"it can't be vendored as submodule",
+					module.Path, repo,
+				)
+			}
+
+			if version == "" {
+				version = module.Version
+			}
+		}
+
+		pending = append(pending, dependency)
+		versions = append(versions, version)
+	}
+
+	// Cloning is done concurrently, but .gitmodules and index can be
+	// modified only by one git process at time.
+	var (
+		added   = 0
+		claimed = map[string]bool{}
+	)
+
+	errs := runParallel(jobs, len(pending), func(index int) error {
+		dependency := pending[index]
+
+		// In GOPATH mode submodule directory is a root of repository, which
+		// can differ from the dependency if it's a subpackage. If root can't
+		// be resolved, dependency is cloned using guessed URLs.
+		if modulePath == "" {
+			root, err := resolveRepoRoot(dependency)
+			if err != nil {
+				logger.Warning(karma.Format(
+					err,
+					"unable to resolve repository root of %s, "+
+						"assuming that it's a root of repository",
+					dependency,
+				))
+			} else if root.Importpath != dependency {
+				logger.Infof(
+					"%s is a part of repository %s", dependency, root.Importpath,
+				)
+
+				dependency = root.Importpath
+			}
+		}
+
+		indexMutex.Lock()
+		_, vendored := submodules[dependency]
+		skip := vendored || claimed[dependency]
+		claimed[dependency] = true
+		indexMutex.Unlock()
+
+		if skip {
+			logger.Debugf("skipping %s, already vendored", dependency)
+			return nil
+		}
+
 		logger.Infof("adding submodule for %s", dependency)
 
-		errs := addVendorSubmodule(dependency, version)
+		url, errs := cloneVendorSubmodule(dependency, versions[index])
 		if errs != nil {
 			top := fmt.Errorf("unable to add submodule for %s", dependency)
 			for _, err := range errs {
@@ -75,7 +161,25 @@ func handleInstall(recursive bool, withTests bool,
 			return top
 		}
 
+		indexMutex.Lock()
+		defer indexMutex.Unlock()
+
+		err := registerVendorSubmodule(dependency, url)
+		if err != nil {
+			return karma.Format(
+				err, "unable to add submodule for %s", dependency,
+			)
+		}
+
 		added++
+
+		return nil
+	})
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
 	}
 
 	if added > 0 {
@@ -88,5 +192,5 @@ func handleInstall(recursive bool, withTests bool,
 		logger.Infof("all dependencies already vendored\n")
 	}
 
-	return nil
+	return writeVendorModules()
 }
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+func handleModules(check bool) error {
+	if modulePath == "" {
+		return errors.New(
+			"go.mod not found, vendor/modules.txt is used only in module mode",
+		)
+	}
+
+	if !check {
+		err := writeVendorModules()
+		if err != nil {
+			return err
+		}
+
+		if !dryRun {
+			logger.Infof("%s is written", vendorModulesFile)
+		}
+
+		return nil
+	}
+
+	versions, err := getVendorModules()
+	if err != nil {
+		return err
+	}
+
+	recorded, err := readVendorModules()
+	if err != nil {
+		return err
+	}
+
+	rendered, err := renderVendorModules(versions)
+	if err != nil {
+		return err
+	}
+
+	expected := parseVendorModules(rendered)
+
+	var mismatches []string
+	for module, expectedModule := range expected {
+		recordedModule, ok := recorded[module]
+		switch {
+		case !ok:
+			mismatches = append(
+				mismatches,
+				fmt.Sprintf("%s %s is not listed", module, expectedModule.Version),
+			)
+
+		case recordedModule.Version != expectedModule.Version:
+			mismatches = append(
+				mismatches,
+				fmt.Sprintf(
+					"%s is listed as %s, but submodule is at %s",
+					module, recordedModule.Version, expectedModule.Version,
+				),
+			)
+
+		default:
+			mismatches = append(
+				mismatches,
+				getPackagesMismatches(
+					module, recordedModule.Packages, expectedModule.Packages,
+				)...,
+			)
+		}
+	}
+
+	for module, recordedModule := range recorded {
+		if _, ok := expected[module]; ok {
+			continue
+		}
+
+		if _, ok := versions[module]; ok {
+			mismatches = append(
+				mismatches,
+				fmt.Sprintf("%s is listed, but not required by go.mod", module),
+			)
+		} else {
+			mismatches = append(
+				mismatches,
+				fmt.Sprintf(
+					"%s %s is not vendored", module, recordedModule.Version,
+				),
+			)
+		}
+	}
+
+	if len(mismatches) > 0 {
+		sort.Strings(mismatches)
+
+		for _, mismatch := range mismatches {
+			logger.Error(mismatch)
+		}
+
+		return fmt.Errorf(
+			"%s doesn't match vendor submodules", vendorModulesFile,
+		)
+	}
+
+	logger.Infof("%s matches vendor submodules", vendorModulesFile)
+
+	return nil
+}
+
+// getPackagesMismatches compares packages of module listed in
+// vendor/modules.txt with packages which are actually used.
+func getPackagesMismatches(module string, recorded, expected []string) []string {
+	var mismatches []string
+
+	listed := map[string]bool{}
+	for _, pkg := range recorded {
+		listed[pkg] = true
+	}
+
+	used := map[string]bool{}
+	for _, pkg := range expected {
+		used[pkg] = true
+
+		if !listed[pkg] {
+			mismatches = append(
+				mismatches,
+				fmt.Sprintf("%s: package %s is not listed", module, pkg),
+			)
+		}
+	}
+
+	for _, pkg := range recorded {
+		if !used[pkg] {
+			mismatches = append(
+				mismatches,
+				fmt.Sprintf("%s: package %s is listed, but not used", module, pkg),
+			)
+		}
+	}
+
+	return mismatches
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/reconquest/karma-go"
+)
+
+type outdatedEntry struct {
+	Importpath   string `json:"importpath"`
+	Branch       string `json:"branch"`
+	Commit       string `json:"commit"`
+	LatestCommit string `json:"latest_commit"`
+	LatestTag    string `json:"latest_tag,omitempty"`
+	Behind       int    `json:"behind"`
+	AgeDays      int    `json:"age_days"`
+}
+
+// handleOutdated reports how far vendored dependencies are behind upstream,
+// negative maxAge disables the age check.
+func handleOutdated(jobs int, maxAge int, format string) error {
+	statuses, err := getVendorSubmodulesStatus()
+	if err != nil {
+		return err
+	}
+
+	gitmodules, err := getVendorGitmodules()
+	if err != nil {
+		return err
+	}
+
+	// git commands in directory of uninitialized submodule would run in
+	// main repository
+	var importpaths []string
+	for importpath, status := range statuses {
+		if status.State == '-' {
+			logger.Warningf(
+				"skipping %s, submodule is not initialized", importpath,
+			)
+			continue
+		}
+
+		importpaths = append(importpaths, importpath)
+	}
+
+	sort.Strings(importpaths)
+
+	entries := make([]outdatedEntry, len(importpaths))
+
+	errs := runParallel(jobs, len(importpaths), func(index int) error {
+		importpath := importpaths[index]
+
+		logger.Debugf("fetching %s", importpath)
+
+		entry, err := getOutdatedEntry(
+			importpath,
+			statuses[importpath].Commit,
+			gitmodules[importpath].Branch,
+		)
+		if err != nil {
+			return karma.Format(
+				err, "unable to check vendor submodule %s", importpath,
+			)
+		}
+
+		entries[index] = entry
+
+		return nil
+	})
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	err = printOutdatedEntries(entries, format)
+	if err != nil {
+		return err
+	}
+
+	if maxAge >= 0 {
+		stale := 0
+		for _, entry := range entries {
+			// age is rounded down, so age of N days means that commit is
+			// at least N days old
+			if entry.Behind > 0 && entry.AgeDays >= maxAge {
+				stale++
+			}
+		}
+
+		if stale > 0 {
+			return fmt.Errorf(
+				"%d vendored dependencies are behind upstream "+
+					"and at least %d days old",
+				stale, maxAge,
+			)
+		}
+	}
+
+	return nil
+}
+
+func getOutdatedEntry(
+	importpath string,
+	commit string,
+	branch string,
+) (outdatedEntry, error) {
+	entry := outdatedEntry{
+		Importpath: importpath,
+		Commit:     commit,
+		Branch:     branch,
+	}
+
+	cwd := filepath.Join(workdir, getVendorPath(importpath))
+
+	if entry.Branch == "" {
+		var err error
+		entry.Branch, err = getVendorSubmoduleDefaultBranch(importpath)
+		if err != nil {
+			return entry, err
+		}
+	}
+
+	_, err := execute(
+		exec.Command("git", "-C", cwd, "fetch", "--tags", "origin", entry.Branch),
+	)
+	if err != nil {
+		return entry, karma.Format(
+			err, "unable to fetch branch %s", entry.Branch,
+		)
+	}
+
+	output, err := execute(
+		exec.Command("git", "-C", cwd, "rev-parse", "origin/"+entry.Branch),
+	)
+	if err != nil {
+		return entry, karma.Format(
+			err, "unable to get latest commit of branch %s", entry.Branch,
+		)
+	}
+
+	entry.LatestCommit = strings.TrimSpace(output)
+
+	output, err = execute(
+		exec.Command(
+			"git", "-C", cwd, "rev-list", "--count",
+			commit+".."+entry.LatestCommit,
+		),
+	)
+	if err != nil {
+		return entry, karma.Format(
+			err, "unable to count commits between %s and %s",
+			commit, entry.LatestCommit,
+		)
+	}
+
+	entry.Behind, err = strconv.Atoi(strings.TrimSpace(output))
+	if err != nil {
+		return entry, karma.Format(
+			err, "unexpected git rev-list output: %q", output,
+		)
+	}
+
+	output, err = execute(
+		exec.Command("git", "-C", cwd, "show", "-s", "--format=%ct", commit),
+	)
+	if err != nil {
+		return entry, karma.Format(
+			err, "unable to get date of commit %s", commit,
+		)
+	}
+
+	timestamp, err := strconv.ParseInt(strings.TrimSpace(output), 10, 64)
+	if err != nil {
+		return entry, karma.Format(
+			err, "invalid commit timestamp: %q", output,
+		)
+	}
+
+	entry.AgeDays = int(time.Since(time.Unix(timestamp, 0)).Hours() / 24)
+
+	tags, err := getSubmoduleTags(cwd)
+	if err != nil {
+		return entry, err
+	}
+
+	allowAll := func(semver) bool { return true }
+	if tag, ok := getLatestSemver(tags, allowAll); ok {
+		entry.LatestTag = tag.String()
+	}
+
+	return entry, nil
+}
+
+func printOutdatedEntries(entries []outdatedEntry, format string) error {
+	switch format {
+	case formatJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "    ")
+
+		err := encoder.Encode(entries)
+		if err != nil {
+			return karma.Format(err, "unable to encode outdated report")
+		}
+
+	case formatTSV:
+		for _, entry := range entries {
+			fmt.Printf(
+				"%s\t%s\t%s\t%s\t%s\t%d\t%d\n",
+				entry.Importpath, entry.Branch, entry.Commit,
+				entry.LatestCommit, entry.LatestTag,
+				entry.Behind, entry.AgeDays,
+			)
+		}
+
+	default:
+		var importpaths []string
+		for _, entry := range entries {
+			importpaths = append(importpaths, entry.Importpath)
+		}
+
+		format := "%-" + strconv.Itoa(getMaxLength(importpaths)) +
+			"s  %.7s -> %.7s  %-10s  %4d behind  %5dd old  %s\n"
+
+		for _, entry := range entries {
+			latestTag := entry.LatestTag
+			if latestTag == "" {
+				latestTag = "-"
+			}
+
+			fmt.Printf(
+				format,
+				entry.Importpath, entry.Commit, entry.LatestCommit,
+				latestTag, entry.Behind, entry.AgeDays, entry.Branch,
+			)
+		}
+	}
+
+	return nil
+}
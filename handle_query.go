@@ -1,16 +1,42 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"sort"
 	"strconv"
+	"strings"
+
+	"github.com/reconquest/karma-go"
 )
 
-func handleQuery(recursive, withTests, onlyVendored bool) error {
+type queryEntry struct {
+	Importpath string `json:"importpath"`
+	Vendored   bool   `json:"vendored"`
+	Commit     string `json:"commit,omitempty"`
+	URL        string `json:"url,omitempty"`
+	Direct     *bool  `json:"direct,omitempty"`
+	Ignored    bool   `json:"ignored,omitempty"`
+}
+
+func handleQuery(recursive, withTests, onlyVendored bool, format string) error {
 	submodules, err := getVendorSubmodules()
 	if err != nil {
 		return err
 	}
 
+	if format != formatText {
+		entries, err := getQueryEntries(
+			submodules, recursive, withTests, onlyVendored,
+		)
+		if err != nil {
+			return err
+		}
+
+		return printQueryEntries(entries, format)
+	}
+
 	if onlyVendored {
 		maxlength := getMaxLength(getKeys(submodules))
 		format := "%-" + strconv.Itoa(maxlength) + "s %s\n"
@@ -19,7 +45,7 @@ func handleQuery(recursive, withTests, onlyVendored bool) error {
 			fmt.Printf(format, submodule, commit)
 		}
 	} else {
-		imports, err := parseImports(recursive, withTests)
+		imports, ignored, err := parseImportsWithIgnored(recursive, withTests)
 		if err != nil {
 			return err
 		}
@@ -42,6 +68,115 @@ func handleQuery(recursive, withTests, onlyVendored bool) error {
 			}
 		}
 
+		if len(ignored) > 0 {
+			fmt.Println()
+			fmt.Println("ignored:")
+
+			for _, importpath := range ignored {
+				fmt.Println(importpath)
+			}
+		}
+	}
+
+	return nil
+}
+
+func getQueryEntries(
+	submodules map[string]string,
+	recursive, withTests, onlyVendored bool,
+) ([]queryEntry, error) {
+	urls, err := getVendorSubmodulesURLs()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []queryEntry{}
+
+	if onlyVendored {
+		for submodule, commit := range submodules {
+			entries = append(entries, queryEntry{
+				Importpath: submodule,
+				Vendored:   true,
+				Commit:     strings.TrimLeft(commit, "+U"),
+				URL:        urls[submodule],
+			})
+		}
+
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Importpath < entries[j].Importpath
+		})
+
+		return entries, nil
+	}
+
+	imports, ignored, err := parseImportsWithIgnored(recursive, withTests)
+	if err != nil {
+		return nil, err
+	}
+
+	direct := map[string]bool{}
+	if recursive {
+		directImports, err := parseImports(false, withTests)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, importpath := range directImports {
+			direct[importpath] = true
+		}
+	}
+
+	for _, importpath := range imports {
+		isDirect := !recursive || direct[importpath]
+
+		commit, vendored := submodules[importpath]
+		entries = append(entries, queryEntry{
+			Importpath: importpath,
+			Vendored:   vendored,
+			Commit:     strings.TrimLeft(commit, "+U"),
+			URL:        urls[importpath],
+			Direct:     &isDirect,
+		})
+	}
+
+	for _, importpath := range ignored {
+		commit, vendored := submodules[importpath]
+		entries = append(entries, queryEntry{
+			Importpath: importpath,
+			Vendored:   vendored,
+			Commit:     strings.TrimLeft(commit, "+U"),
+			URL:        urls[importpath],
+			Ignored:    true,
+		})
+	}
+
+	return entries, nil
+}
+
+func printQueryEntries(entries []queryEntry, format string) error {
+	switch format {
+	case formatJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "    ")
+
+		err := encoder.Encode(entries)
+		if err != nil {
+			return karma.Format(err, "unable to encode query output")
+		}
+
+	case formatTSV:
+		for _, entry := range entries {
+			direct := ""
+			if entry.Direct != nil {
+				direct = strconv.FormatBool(*entry.Direct)
+			}
+
+			fmt.Printf(
+				"%s\t%t\t%s\t%s\t%s\t%t\n",
+				entry.Importpath, entry.Vendored, entry.Commit,
+				entry.URL, direct, entry.Ignored,
+			)
+		}
 	}
 
 	return nil
@@ -29,5 +29,5 @@ func handleRemove(dependencies []string) error {
 		}
 	}
 
-	return nil
+	return writeVendorModules()
 }
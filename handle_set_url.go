@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+func handleSetURL(dependencies []string) error {
+	gitmodules, err := getVendorGitmodules()
+	if err != nil {
+		return err
+	}
+
+	rules, err := getRewriteRules()
+	if err != nil {
+		return err
+	}
+
+	setAll := len(dependencies) == 0
+	if setAll {
+		for importpath := range gitmodules {
+			dependencies = append(dependencies, importpath)
+		}
+
+		sort.Strings(dependencies)
+	}
+
+	changed := 0
+	for _, dependency := range dependencies {
+		// URLs can contain `=` in query strings
+		parts := strings.SplitN(dependency, "=", 2)
+
+		var url string
+		if len(parts) == 2 {
+			dependency, url = parts[0], parts[1]
+		}
+
+		section, ok := gitmodules[dependency]
+		if !ok {
+			return fmt.Errorf("unknown dependency %s", dependency)
+		}
+
+		if url == "" {
+			url, ok = rewriteURL(rules, getRepoImportpath(dependency))
+			if !ok {
+				if setAll {
+					continue
+				}
+
+				return fmt.Errorf(
+					"no URL specified for %s and no rewrite rule matches it",
+					dependency,
+				)
+			}
+		}
+
+		if url == section.URL {
+			logger.Debugf("skipping %s, URL is already %s", dependency, url)
+			continue
+		}
+
+		logger.Infof(
+			"changing URL of vendor submodule %s: %s -> %s",
+			dependency, section.URL, url,
+		)
+
+		err := setVendorSubmoduleURL(dependency, url)
+		if err != nil {
+			return err
+		}
+
+		changed++
+	}
+
+	if changed > 0 {
+		if changed == 1 {
+			logger.Infof("changed URL of 1 submodule")
+		} else {
+			logger.Infof("changed URLs of %d submodules", changed)
+		}
+	} else {
+		logger.Infof("nothing to change")
+	}
+
+	return nil
+}
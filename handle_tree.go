@@ -1,18 +1,20 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/reconquest/karma-go"
 )
 
 type Tree struct {
-	Package string
-	Nested  []*Tree
+	Package string  `json:"package"`
+	Nested  []*Tree `json:"nested"`
 }
 
-func handleTree(withTests bool, usePath bool) error {
+func handleTree(withTests bool, usePath bool, format string) error {
 	packages, err := listPackages()
 	if err != nil {
 		return karma.Format(
@@ -37,13 +39,14 @@ func handleTree(withTests bool, usePath bool) error {
 	}
 
 	var root *Tree
+	var trees []*Tree
 
 	cache := map[string]*Tree{}
 	for i, pkg := range packages {
 		pkgTree := getTree(pkg, withTests, cache, usePath)
 
 		if !inRoot {
-			fmt.Println(formatTree(pkgTree))
+			trees = append(trees, pkgTree)
 		} else {
 			if i == 0 {
 				root = pkgTree
@@ -54,12 +57,51 @@ func handleTree(withTests bool, usePath bool) error {
 	}
 
 	if inRoot {
-		fmt.Println(formatTree(root))
+		trees = []*Tree{root}
+	}
+
+	switch format {
+	case formatJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "    ")
+
+		err := encoder.Encode(trees)
+		if err != nil {
+			return karma.Format(err, "unable to encode tree")
+		}
+
+	case formatTSV:
+		edges := map[string]bool{}
+		for _, tree := range trees {
+			printTreeEdges(tree, edges)
+		}
+
+	default:
+		for _, tree := range trees {
+			fmt.Println(formatTree(tree))
+		}
 	}
 
 	return nil
 }
 
+// printTreeEdges prints every dependency edge of tree as tab-separated
+// importing and imported packages, each edge is printed once.
+func printTreeEdges(tree *Tree, edges map[string]bool) {
+	for _, subtree := range tree.Nested {
+		edge := tree.Package + "\t" + subtree.Package
+		if edges[edge] {
+			continue
+		}
+
+		edges[edge] = true
+
+		fmt.Println(edge)
+
+		printTreeEdges(subtree, edges)
+	}
+}
+
 func formatTree(tree *Tree) karma.Reason {
 	var root karma.Reason
 
@@ -118,7 +160,7 @@ func getTree(
 		imports = append(imports, removeVendorPrefix(importing))
 	}
 
-	imports = filterPackages(imports, 0)
+	imports = removeIgnored(filterPackages(imports, 0))
 
 	logger.Debugf("%s -> %s", pkg, imports)
 
@@ -134,7 +176,7 @@ func getTree(
 	}
 
 	if withTests {
-		testImports := filterPackages(list[0].TestImports, 0)
+		testImports := removeIgnored(filterPackages(list[0].TestImports, 0))
 		for _, imported := range testImports {
 			tree.Nested = append(
 				tree.Nested,
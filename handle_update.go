@@ -5,11 +5,29 @@ import (
 	"strings"
 )
 
+const (
+	updateToLatestTag     = "latest-tag"
+	updateToDefaultBranch = "default-branch"
+)
+
 func handleUpdate(
 	recursive bool,
 	withTests bool,
 	dependencies []string,
+	jobs int,
+	to string,
+	showLog bool,
+	format string,
 ) error {
+	switch to {
+	case "", updateToLatestTag, updateToDefaultBranch:
+	default:
+		return fmt.Errorf(
+			"unknown update target %q, expected %s or %s",
+			to, updateToLatestTag, updateToDefaultBranch,
+		)
+	}
+
 	var err error
 	if len(dependencies) == 0 {
 		dependencies, err = parseImports(recursive, withTests)
@@ -23,15 +41,33 @@ func handleUpdate(
 		return err
 	}
 
-	updated := 0
+	var pending, versions, constraints []string
 	for _, importpath := range dependencies {
-		parts := strings.Split(importpath, "=")
+		// constraints like @>=1.2 contain `=`, so `@` is split first
+		parts := strings.Split(importpath, "@")
+		if len(parts) > 2 {
+			return fmt.Errorf("too many `@` delimiters: %s", importpath)
+		}
+
+		var version, constraint string
+		if len(parts) == 2 {
+			importpath = parts[0]
+			constraint = parts[1]
+		}
+
+		parts = strings.Split(importpath, "=")
 		if len(parts) > 2 {
 			return fmt.Errorf("too many `=` delimiters: %s", importpath)
 		}
 
-		var version string
 		if len(parts) == 2 {
+			if constraint != "" {
+				return fmt.Errorf(
+					"both commit-ish and version constraint are specified: %s",
+					importpath,
+				)
+			}
+
 			importpath = parts[0]
 			version = parts[1]
 		}
@@ -40,20 +76,81 @@ func handleUpdate(
 			return fmt.Errorf("unknown dependency %s", importpath)
 		}
 
+		// git commands in directory of uninitialized submodule would run
+		// in main repository
+		if !isVendorSubmoduleInitialized(importpath) {
+			logger.Warningf(
+				"skipping %s, submodule is not initialized", importpath,
+			)
+			continue
+		}
+
+		if version == "" && constraint == "" && to == "" {
+			version = pinnedVersions[importpath]
+		}
+
+		pending = append(pending, importpath)
+		versions = append(versions, version)
+		constraints = append(constraints, constraint)
+	}
+
+	before, err := getWorktreeVendorCommits()
+	if err != nil {
+		return err
+	}
+
+	// Submodules are updated independently of each other, so it's done
+	// concurrently. Tracked branches recorded in .gitmodules are written
+	// and staged under indexMutex.
+	errs := runParallel(jobs, len(pending), func(index int) error {
+		importpath, version := pending[index], versions[index]
+
+		var err error
+		switch {
+		case version != "":
+
+		case constraints[index] != "":
+			version, err = resolveVendorSubmoduleTag(
+				importpath, constraints[index],
+			)
+
+		case to == updateToLatestTag:
+			version, err = resolveVendorSubmoduleTag(importpath, "")
+
+		case to == updateToDefaultBranch:
+			branch, err := getVendorSubmoduleBranch(importpath, true)
+			if err != nil {
+				return err
+			}
+
+			logger.Infof(
+				"updating vendor submodule %s to branch %s", importpath, branch,
+			)
+
+			return pullVendorSubmodule(importpath, branch)
+		}
+
+		if err != nil {
+			return err
+		}
+
 		if version != "" {
 			logger.Infof("updating vendor submodule %s to %s", importpath, version)
 		} else {
 			logger.Infof("updating vendor submodule %s", importpath)
 		}
 
-		err := updateVendorSubmodule(importpath, version)
+		return updateVendorSubmodule(importpath, version)
+	})
+
+	for _, err := range errs {
 		if err != nil {
 			return err
 		}
-
-		updated++
 	}
 
+	updated := len(pending)
+
 	if updated > 0 {
 		if updated == 1 {
 			logger.Infof("updated 1 dependency submodule")
@@ -64,5 +161,20 @@ func handleUpdate(
 		logger.Infof("nothing to update")
 	}
 
-	return nil
+	if showLog {
+		after, err := getWorktreeVendorCommits()
+		if err != nil {
+			return err
+		}
+
+		err = printVendorChangelogs(
+			getVendorChangelogs(getVendorChanges(before, after)),
+			format,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeVendorModules()
 }
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/reconquest/karma-go"
+)
+
+func handleVerify(recursive, withTests bool) error {
+	imports, err := parseImports(recursive, withTests)
+	if err != nil {
+		return err
+	}
+
+	statuses, err := getVendorSubmodulesStatus()
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+
+	for _, importpath := range imports {
+		if _, ok := statuses[importpath]; !ok {
+			problems = append(
+				problems,
+				fmt.Sprintf("%s is not vendored", importpath),
+			)
+		}
+	}
+
+	for submodule, status := range statuses {
+		found := false
+		for _, importpath := range imports {
+			if importpath == submodule {
+				found = true
+				break
+			}
+		}
+
+		// ignored submodules are kept by -C, so they are not reported
+		if !found && !isIgnored(ignoredImports, submodule) {
+			problems = append(
+				problems,
+				fmt.Sprintf("%s is vendored, but not used", submodule),
+			)
+		}
+
+		switch status.State {
+		case '-':
+			problems = append(
+				problems,
+				fmt.Sprintf("%s is not initialized", submodule),
+			)
+			continue
+
+		case '+':
+			problems = append(
+				problems,
+				fmt.Sprintf(
+					"%s is checked out at %s, which differs from recorded commit",
+					submodule, status.Commit,
+				),
+			)
+
+		case 'U':
+			problems = append(
+				problems,
+				fmt.Sprintf("%s has merge conflicts", submodule),
+			)
+		}
+
+		dirty, err := isVendorSubmoduleDirty(submodule)
+		if err != nil {
+			return err
+		}
+
+		if dirty {
+			problems = append(
+				problems,
+				fmt.Sprintf("%s has uncommitted changes", submodule),
+			)
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+
+		for _, problem := range problems {
+			logger.Error(problem)
+		}
+
+		if len(problems) == 1 {
+			return fmt.Errorf("vendor is not consistent: 1 problem found")
+		}
+
+		return fmt.Errorf(
+			"vendor is not consistent: %d problems found", len(problems),
+		)
+	}
+
+	logger.Infof("vendor is consistent with imports")
+
+	return nil
+}
+
+func isVendorSubmoduleDirty(importpath string) (bool, error) {
+	output, err := execute(
+		exec.Command(
+			"git", "-C", filepath.Join(workdir, getVendorPath(importpath)),
+			"status", "--porcelain",
+		),
+	)
+	if err != nil {
+		return false, karma.Format(
+			err, "unable to get status of vendor submodule %s", importpath,
+		)
+	}
+
+	return strings.TrimSpace(output) != "", nil
+}
@@ -14,37 +14,79 @@ import (
 )
 
 type golistOutput struct {
+	ImportPath   string
+	Standard     bool
+	Module       *moduleInfo
 	Imports      []string
 	Deps         []string
 	TestImports  []string
 	XTestImports []string
 }
 
+// parseImports returns dependencies of project which are not ignored.
 func parseImports(recursive bool, testDependencies bool) ([]string, error) {
+	imports, _, err := parseImportsWithIgnored(recursive, testDependencies)
+	return imports, err
+}
+
+// parseImportsWithIgnored returns dependencies of project and, separately,
+// dependencies which match ignore rules.
+func parseImportsWithIgnored(
+	recursive bool,
+	testDependencies bool,
+) ([]string, []string, error) {
 	var imports []string
 	packages, err := listPackages()
 	if err != nil {
-		return imports, karma.Format(
+		return imports, nil, karma.Format(
 			err, "unable to list packages",
 		)
 	}
 
 	// Ensuring our dependencies exists isn't a strict requirement, therefore
 	// only print a message to stderr rather then completely failing.
+	//
+	// In module mode go list downloads missing modules by itself. Nothing is
+	// downloaded in offline mode.
 
-	err = ensureDependenciesExist(packages, true)
-	if err != nil {
-		logger.Warning(err)
+	if modulePath == "" && !offline {
+		err = ensureDependenciesExist(packages, true)
+		if err != nil {
+			logger.Warning(err)
+		}
 	}
 
 	imports, err = calculateDependencies(packages, recursive, testDependencies)
 	if err != nil {
-		return imports, err
+		return imports, nil, err
 	}
 
 	imports = filterPackages(imports, build.IgnoreVendor)
 	sort.Strings(imports)
-	return imports, nil
+
+	var kept, ignored []string
+	for _, importpath := range imports {
+		if isIgnored(ignoredImports, importpath) {
+			logger.Debugf("ignoring %s", importpath)
+			ignored = append(ignored, importpath)
+		} else {
+			kept = append(kept, importpath)
+		}
+	}
+
+	return kept, ignored, nil
+}
+
+// removeIgnored returns packages which don't match ignore rules.
+func removeIgnored(packages []string) []string {
+	var kept []string
+	for _, pkg := range packages {
+		if !isIgnored(ignoredImports, pkg) {
+			kept = append(kept, pkg)
+		}
+	}
+
+	return kept
 }
 
 func calculateDependencies(
@@ -97,6 +139,10 @@ func calculateDependencies(
 }
 
 func filterPackages(packages []string, mode build.ImportMode) []string {
+	if modulePath != "" {
+		return filterModulePackages(packages)
+	}
+
 	var imports []string
 
 	for _, importing := range packages {
@@ -192,7 +238,7 @@ func golist(packages ...string) ([]golistOutput, error) {
 		args = append(args, pkg)
 	}
 
-	jsonStream, err := execute(exec.Command("go", args...))
+	jsonStream, err := executeStdout(goCommand(args...))
 	if err != nil {
 		return result, err
 	}
@@ -220,7 +266,7 @@ func golist(packages ...string) ([]golistOutput, error) {
 func listPackages() ([]string, error) {
 	var packages []string
 
-	out, err := execute(exec.Command("go", "list", "-e", "./..."))
+	out, err := execute(goCommand("list", "-e", "./..."))
 	if err != nil {
 		return packages, err
 	}
@@ -237,6 +283,10 @@ func listPackages() ([]string, error) {
 }
 
 func isOwnPackage(path string) bool {
+	if modulePath != "" {
+		return path == modulePath || strings.HasPrefix(path, modulePath+"/")
+	}
+
 	for _, gopath := range filepath.SplitList(os.Getenv("GOPATH")) {
 		if strings.HasPrefix(filepath.Join(gopath, "src", path), workdir) {
 			return true
@@ -245,6 +295,29 @@ func isOwnPackage(path string) bool {
 	return false
 }
 
+// goCommand returns go command which ignores vendor directory in module mode,
+// because vendor/modules.txt can be out of sync while manul is working, and
+// doesn't download modules in offline mode. User's GOFLAGS are kept, -mod
+// flag is appended, so it takes precedence.
+func goCommand(args ...string) *exec.Cmd {
+	cmd := exec.Command("go", args...)
+	if modulePath != "" {
+		goflags := strings.TrimSpace(os.Getenv("GOFLAGS") + " -mod=readonly")
+
+		cmd.Env = append(os.Environ(), "GOFLAGS="+goflags)
+	}
+
+	if offline {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+
+		cmd.Env = append(cmd.Env, "GOPROXY=off")
+	}
+
+	return cmd
+}
+
 func unique(input []string) []string {
 	var (
 		list  = make([]string, 0, len(input))
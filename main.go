@@ -1,13 +1,15 @@
 package main
 
 import (
-	"crypto/tls"
-	"net/http"
+	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/kovetskiy/godocs"
 	"github.com/kovetskiy/lorg"
 	"github.com/reconquest/hierr-go"
+	"github.com/reconquest/karma-go"
 )
 
 const (
@@ -20,9 +22,14 @@ Usage:
     manul [options] -I [<dependency>...]
     manul [options] -U [<dependency>...]
     manul [options] -R [<dependency>...]
+    manul [options] -M [<dependency>...]
     manul [options] -Q [-o]
     manul [options] -C
+    manul [options] -V
+    manul [options] -S [--check]
+    manul [options] -O [--max-age <days>]
     manul [options] -T
+    manul [options] -D [<rev> [<rev>]]
     manul -h
     manul --version
 
@@ -32,19 +39,110 @@ Options:
                      install all detected dependencies.
                      You can specify commit-ish that will be used as target to
                      instal: -I golang.org/x/net=34a235h1
+        --convert   Clone dependencies which are managed by mercurial,
+                     subversion or bazaar using git remote helpers
+                     (git-remote-hg and so on), so they can be vendored as
+                     git submodules.
     -U --update     Update specified already-vendored dependencies.
                      If you don't specify any vendored dependency, manul will
-                     update all already-vendored dependencies.
+                     update all already-vendored dependencies to the latest
+                     commit of tracked branch: the one recorded in
+                     .gitmodules or default branch of remote repository.
                      You can specify commit-ish that will be used as target to
                      update: -U golang.org/x/net=34a235h1
+                     or semver constraint which is resolved against remote
+                     tags: -U github.com/foo/bar@^1.4
+        --to <target>
+                    Update to latest-tag or default-branch of remote
+                     repository, default-branch is detected again and
+                     recorded into .gitmodules.
+        --log       Show upstream log, number of changed files and
+                     force-pushes of updated dependencies.
     -R --remove     Stop vendoring of specified dependencies.
                      If you don't specify any dependency, manul will
                      remove all vendored dependencies.
+    -M --set-url    Change remote URL of specified vendored dependencies:
+                     -M github.com/foo/bar=https://git.corp/foo/bar
+                     If URL is not specified, it's taken from manul.rewrite
+                     rules. If you don't specify any dependency, manul will
+                     apply rewrite rules to all vendored dependencies.
+                     URL is changed only if recorded commit of dependency
+                     exists at new location.
     -Q --query      List all dependencies.
         -o          List only already-vendored dependencies.
     -C --clean      Detect all unused vendored dependencies and remove it.
+    -V --verify     Check that all dependencies are vendored, no unused
+                     dependencies are vendored and vendor submodules are
+                     checked out at recorded commits without local changes.
+                     Nothing is changed, exit code is non-zero if any
+                     problem is found.
+    -S --sync-modules
+                    Write vendor/modules.txt using versions of vendored
+                     submodules, module mode only.
+        --check     Do not write anything, fail if vendor/modules.txt
+                     doesn't match vendored submodules.
+    -O --outdated   Fetch remotes of vendored dependencies and show which of
+                     them are behind upstream: pinned and latest commits of
+                     tracked branch, latest tag, number of commits behind
+                     and age of pinned commit.
+        --max-age <days>
+                    Fail if any dependency is behind upstream and its
+                     pinned commit is at least specified number of days
+                     old, 0 fails on any outdated dependency.
+    -D --diff       Show how vendor submodules differ between two revisions
+                     of repository: added, removed, updated and downgraded
+                     dependencies with upstream log, number of changed files
+                     and force-pushes. If only one revision is specified,
+                     it's compared to working tree, HEAD is used by default.
     -T --tree       Show dependencies tree.
 	  -i --import   Show used import path instead of git repo.
+    --ignore <patterns>
+                    Comma-separated list of glob patterns of import paths
+                     which -Q, -I, -C and -T ignore in addition to
+                     manul.ignore rules: --ignore 'github.com/corp/*'
+    --format <fmt>  Output format of -Q, -O, -D, -T and -U --log: text, json
+                     or tsv.
+                     Query in tsv prints import path, vendored flag, commit,
+                     remote URL, direct and ignored flags separated by
+                     tabs, tree in tsv prints importing and imported
+                     package per line.
+                     [default: text]
+    -j --jobs <n>   Number of dependencies which -I, -U and -O clone or fetch
+                     concurrently. [default: 1]
+    --offline       Do not access network for resolving import paths, use only
+                     cache of previous runs and .gitmodules.
+    --proxy         Ask module proxies from GOPROXY for repository URL and
+                     commit of module version before resolving import path,
+                     useful for repositories which are hard to resolve or
+                     clone directly.
+    --cache-ttl <duration>
+                    Time during which resolved import paths are cached.
+                     [default: 24h]
+    --ca-file <path>
+                    Trust certificates from PEM file in addition to system
+                     ones when fetching go-import meta and cloning.
+    --client-cert <path>
+                    Use client certificate from PEM file.
+    --client-key <path>
+                    Use private key of client certificate from PEM file,
+                     it's read from --client-cert file if not specified.
+    --http-proxy <url>
+                    Use HTTP proxy, by default proxy is taken from
+                     HTTPS_PROXY, HTTP_PROXY and NO_PROXY variables.
+    --insecure <hosts>
+                    Comma-separated list of hosts which TLS certificates
+                     are not verified.
+    --insecure-skip-verify
+                    Do not verify TLS certificates of any host.
+    --all-projects  Run command for every project of repository: each
+                     directory with go.mod or .manul file has own vendor
+                     directory.
+    --commit        Commit changes made by -I, -U, -R and -C: .gitmodules,
+                     vendor submodules and module files are committed with
+                     message listing changed dependencies, their old and new
+                     commits and upstream log of updated ones.
+    --dry-run       Detect changes and print git commands which -I, -U, -R,
+                     -M, -C and -S would run, but don't run them.
     -t --testing    Include dependencies from tests.
     -r --recursive  Be recursive.
     -h --help       Show help message.
@@ -54,33 +152,82 @@ Options:
 `
 )
 
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatTSV  = "tsv"
+)
+
 var (
 	verbose bool
 	tracing bool
+	dryRun  bool
 	testing bool
 	workdir string
 	logger  = lorg.NewLog()
+
+	// offline disables network access for resolving import paths.
+	offline bool
+
+	// cacheTTL is a time during which resolved import paths are taken from
+	// cache.
+	cacheTTL time.Duration
+
+	// useProxy enables resolution of module repositories and commits using
+	// module proxies from GOPROXY.
+	useProxy bool
+
+	// convertVCS allows to clone non-git repositories using git remote
+	// helpers.
+	convertVCS bool
+
+	// toplevel is a top-level directory of git repository and projectPrefix
+	// is a path of working directory relative to it.
+	toplevel      string
+	projectPrefix string
+
+	// autoCommit enables committing of vendor changes made by -I, -U, -R
+	// and -C.
+	autoCommit bool
+
+	// vendorDir is a directory of vendor submodules relative to project
+	// directory.
+	vendorDir = "vendor"
+
+	// ignoredImports, pinnedVersions and tokenHosts are taken from project
+	// config.
+	ignoredImports []string
+	pinnedVersions map[string]string
+	tokenHosts     []string
+
+	// modulePath is a path of the module declared in go.mod, it's empty when
+	// project is built in GOPATH mode.
+	modulePath string
 )
 
 func init() {
 	var err error
 
+	// --integration-test is internal flag of test suite, so it's not
+	// documented in usage.
 	newArgs := make([]string, 0, len(os.Args))
 	for _, arg := range os.Args {
 		if arg == "--integration-test" {
 			testing = true
-		} else if arg == "--insecure-skip-verify" {
-			http.DefaultClient.Transport = &http.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: true,
-				},
-			}
 		} else {
 			newArgs = append(newArgs, arg)
 		}
 	}
 	os.Args = newArgs
 
+	// git must not ask for credentials in terminal, otherwise manul hangs
+	// on private repositories instead of reporting failure; GIT_ASKPASS and
+	// credential helpers are still used.
+	err = os.Setenv("GIT_TERMINAL_PROMPT", "0")
+	if err != nil {
+		hierr.Fatalf(err, "unable to set GIT_TERMINAL_PROMPT")
+	}
+
 	workdir, err = os.Getwd()
 	if err != nil {
 		hierr.Fatalf(
@@ -95,44 +242,196 @@ func init() {
 func main() {
 	args := godocs.MustParse(usage, version)
 
+	if args["--verbose"].(bool) {
+		verbose = true
+		logger.SetLevel(lorg.LevelDebug)
+	}
+
+	if args["--trace"].(bool) {
+		logger.SetLevel(lorg.LevelTrace)
+	}
+
+	if args["--dry-run"].(bool) {
+		dryRun = true
+		logger.Infof("dry run, repository will not be changed")
+	}
+
+	convertVCS = args["--convert"].(bool)
+	offline = args["--offline"].(bool)
+	useProxy = args["--proxy"].(bool)
+	autoCommit = args["--commit"].(bool)
+
+	var transport transportOptions
+	transport.CAFile, _ = args["--ca-file"].(string)
+	transport.ClientCert, _ = args["--client-cert"].(string)
+	transport.ClientKey, _ = args["--client-key"].(string)
+	transport.Proxy, _ = args["--http-proxy"].(string)
+	if insecure, ok := args["--insecure"].(string); ok {
+		transport.Insecure = splitList(insecure)
+	}
+	if args["--insecure-skip-verify"].(bool) {
+		transport.Insecure = []string{"*"}
+	}
+
+	err := configureTransport(transport)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	format := args["--format"].(string)
+	switch format {
+	case formatText, formatJSON, formatTSV:
+	default:
+		logger.Fatalf("unknown output format: %s", format)
+	}
+
+	jobs, err := strconv.Atoi(args["--jobs"].(string))
+	if err != nil || jobs < 1 {
+		logger.Fatalf("invalid number of jobs: %s", args["--jobs"])
+	}
+
+	cacheTTL, err = time.ParseDuration(args["--cache-ttl"].(string))
+	if err != nil {
+		logger.Fatalf("invalid cache TTL: %s", args["--cache-ttl"])
+	}
+
+	err = setProjectDir(workdir)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	handleInterrupts()
+
+	if !args["--all-projects"].(bool) {
+		err = runProject(args, jobs, format)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		return
+	}
+
+	projects, err := getProjectDirs()
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	for _, project := range projects {
+		logger.Infof("processing project %s", project)
+
+		err = setProjectDir(project)
+		if err == nil {
+			err = runProject(args, jobs, format)
+		}
+
+		if err != nil {
+			logger.Fatal(karma.Format(err, "project %s failed", project))
+		}
+	}
+}
+
+// runProject runs command for project in working directory, project config
+// is read every time, because projects of monorepo can have own configs.
+func runProject(args map[string]interface{}, jobs int, format string) error {
 	var (
 		dependencies, _ = args["<dependency>"].([]string)
 		recursive       = args["--recursive"].(bool)
 		withTests       = args["--testing"].(bool)
+		err             error
 	)
 
-	if args["--verbose"].(bool) {
-		verbose = true
-		logger.SetLevel(lorg.LevelDebug)
+	modulePath, err = getModulePath()
+	if err != nil {
+		return err
 	}
 
-	if args["--trace"].(bool) {
-		logger.SetLevel(lorg.LevelTrace)
+	if modulePath != "" {
+		logger.Debugf("working in module mode: %s", modulePath)
+	}
+
+	config, err := getProjectConfig()
+	if err != nil {
+		return err
+	}
+
+	recursive = recursive || config.Recursive
+	withTests = withTests || config.Testing
+	ignoredImports = config.Ignore
+	if ignore, ok := args["--ignore"].(string); ok {
+		ignoredImports = append(ignoredImports, splitList(ignore)...)
+	}
+	pinnedVersions = config.Pins
+	tokenHosts = config.TokenHosts
+	vendorDir = config.VendorDir
+
+	if modulePath != "" && vendorDir != "vendor" {
+		return fmt.Errorf(
+			"vendor directory %s is not supported in module mode, "+
+				"go uses only vendor directory of module",
+			vendorDir,
+		)
 	}
 
-	var err error
 	switch {
 	case args["--tree"].(bool):
-		err = handleTree(withTests, args["--import"].(bool))
+		err = handleTree(withTests, args["--import"].(bool), format)
 
 	case args["--install"].(bool):
-		err = handleInstall(recursive, withTests, dependencies)
+		err = withTransaction(withVendorCommit(func() error {
+			return handleInstall(recursive, withTests, dependencies, jobs)
+		}))
 
 	case args["--update"].(bool):
-		err = handleUpdate(recursive, withTests, dependencies)
+		to, _ := args["--to"].(string)
+		err = withTransaction(withVendorCommit(func() error {
+			return handleUpdate(
+				recursive, withTests, dependencies, jobs, to,
+				args["--log"].(bool), format,
+			)
+		}))
 
 	case args["--query"].(bool):
 		onlyVendored := args["-o"].(bool)
-		err = handleQuery(recursive, withTests, onlyVendored)
+		err = handleQuery(recursive, withTests, onlyVendored, format)
+
+	case args["--set-url"].(bool):
+		err = withTransaction(func() error {
+			return handleSetURL(dependencies)
+		})
 
 	case args["--remove"].(bool):
-		err = handleRemove(dependencies)
+		err = withTransaction(withVendorCommit(func() error {
+			return handleRemove(dependencies)
+		}))
 
 	case args["--clean"].(bool):
-		err = handleClean(recursive, withTests)
-	}
+		err = withTransaction(withVendorCommit(func() error {
+			return handleClean(recursive, withTests)
+		}))
 
-	if err != nil {
-		logger.Fatal(err)
+	case args["--outdated"].(bool):
+		maxAge := -1
+		if value, ok := args["--max-age"].(string); ok {
+			maxAge, err = strconv.Atoi(value)
+			if err != nil || maxAge < 0 {
+				return fmt.Errorf("invalid max age: %s", value)
+			}
+		}
+
+		err = handleOutdated(jobs, maxAge, format)
+
+	case args["--diff"].(bool):
+		revs, _ := args["<rev>"].([]string)
+		err = handleDiff(revs, format)
+
+	case args["--verify"].(bool):
+		err = handleVerify(recursive, withTests)
+
+	case args["--sync-modules"].(bool):
+		err = withTransaction(func() error {
+			return handleModules(args["--check"].(bool))
+		})
 	}
+
+	return err
 }
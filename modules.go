@@ -0,0 +1,641 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/reconquest/karma-go"
+)
+
+const vendorModulesFile = "vendor/modules.txt"
+
+var (
+	reMajorVersion   = regexp.MustCompile(`^v[0-9]+$`)
+	rePseudoRevision = regexp.MustCompile(`[.-](?:0\.)?[0-9]{14}-([0-9a-f]{12})(?:\+incompatible)?$`)
+)
+
+type goModFile struct {
+	Module struct {
+		Path string
+	}
+	Go      string
+	Require []struct {
+		Path     string
+		Version  string
+		Indirect bool
+	}
+}
+
+type moduleInfo struct {
+	Path      string
+	Version   string
+	Main      bool
+	Indirect  bool
+	GoVersion string
+	Replace   *moduleInfo
+}
+
+// getModulePath returns path of the module declared in go.mod of current
+// project or empty string if project is built in GOPATH mode.
+func getModulePath() (string, error) {
+	output, err := execute(exec.Command("go", "env", "GOMOD"))
+	if err != nil {
+		return "", karma.Format(
+			err, "unable to get location of go.mod file",
+		)
+	}
+
+	gomod := strings.TrimSpace(output)
+	if gomod == "" || gomod == os.DevNull {
+		return "", nil
+	}
+
+	modfile, err := getGoModFile()
+	if err != nil {
+		return "", err
+	}
+
+	return modfile.Module.Path, nil
+}
+
+func getGoModFile() (*goModFile, error) {
+	output, err := executeStdout(exec.Command("go", "mod", "edit", "-json"))
+	if err != nil {
+		return nil, karma.Format(
+			err, "unable to read go.mod file",
+		)
+	}
+
+	var modfile goModFile
+	err = json.Unmarshal([]byte(output), &modfile)
+	if err != nil {
+		return nil, karma.Format(
+			err, "unable to decode go.mod file",
+		)
+	}
+
+	return &modfile, nil
+}
+
+func getModuleGraph() (map[string]moduleInfo, error) {
+	output, err := executeStdout(
+		goCommand("list", "-m", "-json", "all"),
+	)
+	if err != nil {
+		return nil, karma.Format(
+			err, "unable to list modules of current project",
+		)
+	}
+
+	modules := map[string]moduleInfo{}
+
+	decoder := json.NewDecoder(strings.NewReader(output))
+	for decoder.More() {
+		var module moduleInfo
+
+		err := decoder.Decode(&module)
+		if err != nil {
+			return nil, karma.Format(err, "failed to decode go list output")
+		}
+
+		if module.Main {
+			continue
+		}
+
+		modules[module.Path] = module
+	}
+
+	return modules, nil
+}
+
+// findModule returns module which provides given package, the module with
+// the longest matching path wins.
+func findModule(modules map[string]moduleInfo, importpath string) (moduleInfo, bool) {
+	var (
+		found moduleInfo
+		ok    bool
+	)
+
+	for path, module := range modules {
+		if importpath != path && !strings.HasPrefix(importpath, path+"/") {
+			continue
+		}
+
+		if len(path) > len(found.Path) {
+			found = module
+			ok = true
+		}
+	}
+
+	return found, ok
+}
+
+// getModuleRevision converts module version into commit-ish that can be
+// checked out in the module repository.
+func getModuleRevision(version string) string {
+	if matches := rePseudoRevision.FindStringSubmatch(version); matches != nil {
+		return matches[1]
+	}
+
+	return strings.TrimSuffix(version, "+incompatible")
+}
+
+// trimMajorVersion removes major version suffix like /v2 from module path.
+func trimMajorVersion(importpath string) string {
+	index := strings.LastIndex(importpath, "/")
+	if index > 0 && reMajorVersion.MatchString(importpath[index+1:]) {
+		return importpath[:index]
+	}
+
+	return importpath
+}
+
+// getRepoImportpath returns import path of repository that contains given
+// module, major version suffix is not a part of repository path.
+func getRepoImportpath(importpath string) string {
+	parts := strings.Split(trimMajorVersion(importpath), "/")
+
+	for _, site := range []string{"github.com/", "bitbucket.org/"} {
+		if strings.HasPrefix(importpath, site) && len(parts) > 3 {
+			parts = parts[:3]
+		}
+	}
+
+	return strings.Join(parts, "/")
+}
+
+func filterModulePackages(packages []string) []string {
+	var imports []string
+
+	if len(packages) == 0 {
+		return imports
+	}
+
+	data, err := golist(packages...)
+	if err != nil {
+		logger.Warning(err)
+		return imports
+	}
+
+	for _, pkg := range data {
+		if pkg.Standard || pkg.Module == nil || pkg.Module.Main {
+			continue
+		}
+
+		importpath := pkg.Module.Path
+
+		if isOwnPackage(importpath) {
+			continue
+		}
+
+		found := false
+		for _, imported := range imports {
+			if importpath == imported {
+				found = true
+				break
+			}
+		}
+
+		if found {
+			continue
+		}
+
+		imports = append(imports, importpath)
+	}
+
+	return imports
+}
+
+// getVendorModules returns versions of vendored modules calculated from
+// commits which submodules are checked out at. Versions of uninitialized
+// submodules can't be calculated, so error is returned for them.
+func getVendorModules() (map[string]string, error) {
+	submodules, err := getVendorSubmodules()
+	if err != nil {
+		return nil, err
+	}
+
+	var uninitialized []string
+	for submodule := range submodules {
+		if !isVendorSubmoduleInitialized(submodule) {
+			uninitialized = append(uninitialized, submodule)
+		}
+	}
+
+	if len(uninitialized) > 0 {
+		sort.Strings(uninitialized)
+
+		return nil, fmt.Errorf(
+			"unable to get versions of uninitialized vendor submodules: %s, "+
+				"run git submodule update --init",
+			strings.Join(uninitialized, ", "),
+		)
+	}
+
+	versions := map[string]string{}
+	for submodule := range submodules {
+		version, err := getSubmoduleVersion(submodule)
+		if err != nil {
+			return nil, karma.Format(
+				err, "unable to get version of vendor submodule %s", submodule,
+			)
+		}
+
+		versions[submodule] = version
+	}
+
+	return versions, nil
+}
+
+// getSubmoduleVersion returns module version of vendor submodule: a semver
+// tag which points to checked out commit or a pseudo-version otherwise.
+func getSubmoduleVersion(importpath string) (string, error) {
+	dir := filepath.Join(workdir, getVendorPath(importpath))
+
+	major, hasMajor := getModuleMajor(importpath)
+	isAllowed := getModuleVersionFilter(importpath)
+
+	suffix := func(version semver) string {
+		if !hasMajor && version.Major >= 2 {
+			return "+incompatible"
+		}
+
+		return ""
+	}
+
+	tags, err := getSubmoduleTags(dir, "--points-at", "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	if tag, ok := getLatestSemver(tags, isAllowed); ok {
+		return tag.String() + suffix(tag), nil
+	}
+
+	output, err := execute(
+		exec.Command("git", "-C", dir, "show", "-s", "--format=%H %ct", "HEAD"),
+	)
+	if err != nil {
+		return "", karma.Format(
+			err, "unable to get commit of %s", dir,
+		)
+	}
+
+	fields := strings.Fields(output)
+	if len(fields) != 2 || len(fields[0]) < 12 {
+		return "", fmt.Errorf("unexpected git show output: %q", output)
+	}
+
+	timestamp, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return "", karma.Format(
+			err, "invalid commit timestamp: %s", fields[1],
+		)
+	}
+
+	revision := time.Unix(timestamp, 0).UTC().Format("20060102150405") +
+		"-" + fields[0][:12]
+
+	tags, err = getSubmoduleTags(dir, "--merged", "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	base, ok := getLatestSemver(tags, isAllowed)
+	switch {
+	case !ok:
+		return fmt.Sprintf("v%d.0.0-%s", major, revision), nil
+
+	case base.Prerelease != "":
+		return base.String() + ".0." + revision + suffix(base), nil
+
+	default:
+		base.Patch++
+		return base.String() + "-0." + revision + suffix(base), nil
+	}
+}
+
+func getSubmoduleTags(dir string, filter ...string) ([]string, error) {
+	output, err := execute(
+		exec.Command(
+			"git", append([]string{"-C", dir, "tag", "--list"}, filter...)...,
+		),
+	)
+	if err != nil {
+		return nil, karma.Format(
+			err, "unable to list tags of %s", dir,
+		)
+	}
+
+	return strings.Fields(output), nil
+}
+
+func getLatestSemver(
+	tags []string,
+	isAllowed func(semver) bool,
+) (semver, bool) {
+	var (
+		latest semver
+		found  bool
+	)
+
+	for _, tag := range tags {
+		version, ok := parseSemver(tag)
+		if !ok || !isAllowed(version) {
+			continue
+		}
+
+		if !found || latest.Less(version) {
+			latest = version
+			found = true
+		}
+	}
+
+	return latest, found
+}
+
+// getModuleVersionFilter returns function which reports whether tag version
+// can be used as version of given vendored module: major version must match
+// suffix of module path, v2+ tags without suffix are allowed only as
+// +incompatible, when repository has no go.mod.
+func getModuleVersionFilter(importpath string) func(semver) bool {
+	major, hasMajor := getModuleMajor(importpath)
+
+	_, err := os.Stat(filepath.Join(workdir, getVendorPath(importpath), "go.mod"))
+	incompatible := !hasMajor && os.IsNotExist(err)
+
+	return func(version semver) bool {
+		if hasMajor {
+			return version.Major == major
+		}
+
+		return version.Major <= 1 || incompatible
+	}
+}
+
+// getModuleMajor returns major version specified as suffix of module path.
+func getModuleMajor(importpath string) (int, bool) {
+	trimmed := trimMajorVersion(importpath)
+	if trimmed == importpath {
+		return 0, false
+	}
+
+	major, err := strconv.Atoi(strings.TrimPrefix(importpath, trimmed+"/v"))
+	if err != nil {
+		return 0, false
+	}
+
+	return major, true
+}
+
+// writeVendorModules writes vendor/modules.txt describing vendored modules,
+// so go build -mod=vendor accepts vendor directory populated by submodules.
+// Requirements of go.mod are updated to match versions of submodules.
+// Does nothing in GOPATH mode.
+func writeVendorModules() error {
+	if modulePath == "" {
+		return nil
+	}
+
+	if dryRun {
+		logger.Infof("%s would be regenerated", vendorModulesFile)
+		return nil
+	}
+
+	versions, err := getVendorModules()
+	if err != nil {
+		return err
+	}
+
+	modfile, err := getGoModFile()
+	if err != nil {
+		return err
+	}
+
+	requirementsChanged := false
+	for _, require := range modfile.Require {
+		version, ok := versions[require.Path]
+		if !ok || version == require.Version {
+			continue
+		}
+
+		logger.Infof(
+			"updating go.mod requirement %s %s -> %s",
+			require.Path, require.Version, version,
+		)
+
+		_, err := execute(
+			exec.Command(
+				"go", "mod", "edit", "-require="+require.Path+"@"+version,
+			),
+		)
+		if err != nil {
+			return karma.Format(
+				err, "unable to update go.mod requirement %s", require.Path,
+			)
+		}
+
+		requirementsChanged = true
+	}
+
+	contents, err := renderVendorModules(versions)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(
+		filepath.Join(workdir, vendorModulesFile),
+		[]byte(contents),
+		0644,
+	)
+	if err != nil {
+		return karma.Format(
+			err, "unable to write %s", vendorModulesFile,
+		)
+	}
+
+	files := []string{vendorModulesFile}
+
+	// go.mod must be in sync with vendor/modules.txt in index too
+	if requirementsChanged {
+		files = append(files, "go.mod")
+	}
+
+	_, err = execute(exec.Command("git", append([]string{"add"}, files...)...))
+	if err != nil {
+		return karma.Format(
+			err, "unable to add %s to index", strings.Join(files, " and "),
+		)
+	}
+
+	if requirementsChanged {
+		logger.Infof("go.mod requirements are updated and staged")
+	}
+
+	return nil
+}
+
+func renderVendorModules(versions map[string]string) (string, error) {
+	modfile, err := getGoModFile()
+	if err != nil {
+		return "", err
+	}
+
+	modules, err := getModuleGraph()
+	if err != nil {
+		return "", err
+	}
+
+	packages, err := listModulePackages()
+	if err != nil {
+		return "", err
+	}
+
+	explicit := map[string]bool{}
+	for _, require := range modfile.Require {
+		explicit[require.Path] = true
+	}
+
+	paths := getKeys(versions)
+	sort.Strings(paths)
+
+	buffer := &strings.Builder{}
+	for _, path := range paths {
+		module, ok := modules[path]
+		if !ok {
+			logger.Warningf(
+				"vendored submodule %s is not required by go.mod", path,
+			)
+			continue
+		}
+
+		if module.Replace != nil {
+			fmt.Fprintf(
+				buffer, "# %s %s => %s %s\n",
+				module.Path, versions[path],
+				module.Replace.Path, module.Replace.Version,
+			)
+		} else {
+			fmt.Fprintf(buffer, "# %s %s\n", module.Path, versions[path])
+		}
+
+		var annotations []string
+		if explicit[module.Path] {
+			annotations = append(annotations, "explicit")
+		}
+
+		if module.GoVersion != "" {
+			annotations = append(annotations, "go "+module.GoVersion)
+		}
+
+		if len(annotations) > 0 {
+			fmt.Fprintf(buffer, "## %s\n", strings.Join(annotations, "; "))
+		}
+
+		for _, pkg := range packages[module.Path] {
+			fmt.Fprintln(buffer, pkg)
+		}
+	}
+
+	return buffer.String(), nil
+}
+
+// vendorModule is a module listed in vendor/modules.txt with packages which
+// are used from it.
+type vendorModule struct {
+	Version  string
+	Packages []string
+}
+
+// readVendorModules returns modules recorded in vendor/modules.txt.
+func readVendorModules() (map[string]vendorModule, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(workdir, vendorModulesFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]vendorModule{}, nil
+		}
+
+		return nil, karma.Format(
+			err, "unable to read %s", vendorModulesFile,
+		)
+	}
+
+	return parseVendorModules(string(contents)), nil
+}
+
+func parseVendorModules(contents string) map[string]vendorModule {
+	modules := map[string]vendorModule{}
+
+	var current string
+	for _, line := range strings.Split(contents, "\n") {
+		switch {
+		case strings.HasPrefix(line, "## "), line == "":
+
+		case strings.HasPrefix(line, "# "):
+			current = ""
+
+			fields := strings.Fields(strings.TrimPrefix(line, "# "))
+			if len(fields) < 2 {
+				continue
+			}
+
+			current = fields[0]
+			modules[current] = vendorModule{Version: fields[1]}
+
+		case current != "":
+			module := modules[current]
+			module.Packages = append(module.Packages, line)
+			modules[current] = module
+		}
+	}
+
+	return modules
+}
+
+// listModulePackages returns packages used by current project grouped by
+// modules which provide them.
+func listModulePackages() (map[string][]string, error) {
+	output, err := executeStdout(
+		goCommand(
+			"list", "-e", "-deps", "-test",
+			"-f", "{{if .Module}}{{.ImportPath}} {{.Module.Path}}{{end}}",
+			"./...",
+		),
+	)
+	if err != nil {
+		return nil, karma.Format(
+			err, "unable to list packages of dependencies",
+		)
+	}
+
+	packages := map[string][]string{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+
+		pkg, module := fields[0], fields[1]
+		if strings.HasSuffix(pkg, ".test") {
+			continue
+		}
+
+		packages[module] = append(packages[module], pkg)
+	}
+
+	for module := range packages {
+		packages[module] = unique(packages[module])
+		sort.Strings(packages[module])
+	}
+
+	return packages, nil
+}
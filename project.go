@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/reconquest/karma-go"
+)
+
+// setProjectDir makes given directory a working directory of manul and
+// detects its location in git repository.
+func setProjectDir(dir string) error {
+	err := os.Chdir(dir)
+	if err != nil {
+		return karma.Format(err, "unable to change directory to %s", dir)
+	}
+
+	workdir = dir
+
+	output, err := executeStdout(
+		exec.Command("git", "rev-parse", "--show-toplevel", "--show-prefix"),
+	)
+	if err != nil {
+		// not a git repository, git commands will report it by themselves
+		toplevel, projectPrefix = dir, ""
+		return nil
+	}
+
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+
+	toplevel = lines[0]
+	projectPrefix = ""
+	if len(lines) > 1 {
+		projectPrefix = strings.TrimSuffix(lines[1], "/")
+	}
+
+	if projectPrefix != "" {
+		logger.Debugf(
+			"working in subdirectory %s of repository %s",
+			projectPrefix, toplevel,
+		)
+	}
+
+	return nil
+}
+
+// getToplevelPath converts path relative to project directory into path
+// relative to top-level directory of repository, paths in .gitmodules and
+// .git/modules are relative to it.
+func getToplevelPath(relative string) string {
+	return path.Join(projectPrefix, relative)
+}
+
+// getProjectPath converts path relative to top-level directory of repository
+// into path relative to project directory, it's reverse of getToplevelPath.
+func getProjectPath(relative string) string {
+	if projectPrefix == "" {
+		return relative
+	}
+
+	return path.Join(
+		strings.Repeat("../", strings.Count(projectPrefix, "/")+1), relative,
+	)
+}
+
+// getProjectDirs returns directories of all Go projects in repository, a
+// project is a directory with go.mod or .manul file.
+func getProjectDirs() ([]string, error) {
+	output, err := executeStdout(
+		exec.Command(
+			"git", "-C", toplevel, "ls-files", "--",
+			":(glob)**/go.mod", ":(glob)**/"+configFile,
+		),
+	)
+	if err != nil {
+		return nil, karma.Format(err, "unable to list projects in repository")
+	}
+
+	found := map[string]bool{}
+	for _, file := range strings.Split(output, "\n") {
+		if file == "" {
+			continue
+		}
+
+		dir := path.Dir(file)
+		if isSkippedProjectPath(dir) {
+			continue
+		}
+
+		found[dir] = true
+	}
+
+	var dirs []string
+	for dir := range found {
+		dirs = append(dirs, filepath.Join(toplevel, dir))
+	}
+
+	sort.Strings(dirs)
+
+	return dirs, nil
+}
+
+// isSkippedProjectPath reports whether path is inside testdata or vendor
+// directory, go.mod files there belong to test fixtures and dependencies
+// instead of projects.
+func isSkippedProjectPath(dir string) bool {
+	for _, name := range strings.Split(dir, "/") {
+		if name == "testdata" || name == "vendor" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/reconquest/karma-go"
+)
+
+const (
+	tagMetaGoImport = "meta[name=go-import]"
+	tagMetaGoSource = "meta[name=go-source]"
+)
+
+// NOTE: This list is copied from
+// https://github.com/golang/go/blob/10538a8f9e2e718a47633ac5a6e90415a2c3f5f1/src/cmd/go/vcs.go#L821-L861
+// values are numbers of path elements in repository root import path.
+var wellKnownSites = map[string]int{
+	"github.com/":        3,
+	"bitbucket.org/":     3,
+	"hub.jazz.net/git/":  4,
+	"git.apache.org/":    2,
+	"git.openstack.org/": 3,
+}
+
+// repoRoot describes repository which contains package.
+type repoRoot struct {
+	// Importpath is import path of repository root, packages of
+	// repository are located in vendor/<Importpath>.
+	Importpath string
+	VCS        string
+	URL        string
+
+	// Home is home page of repository taken from go-source meta.
+	Home string
+}
+
+// metaImport is a content of go-import meta:
+// <meta name="go-import" content="import-prefix vcs repo-root">
+type metaImport struct {
+	Prefix string
+	VCS    string
+	URL    string
+}
+
+// repoRoots is a cache of resolved repository roots, it's loaded from disk
+// on first use and saved after every new resolution.
+var repoRoots = struct {
+	sync.Mutex
+	cache map[string]cachedRepoRoot
+}{}
+
+// resolveRepoRoot returns repository root of given import path. For
+// well-known code hostings root is taken from import path, for others the
+// longest go-import meta prefix which matches import path is used, pages
+// with ?go-get=1 are requested for import path and its parents until any
+// matching meta is found.
+//
+// Results are cached on disk for cacheTTL, in offline mode only cache,
+// well-known sites and .gitmodules are used.
+func resolveRepoRoot(importpath string) (repoRoot, error) {
+	// roots of well-known sites are resolved without network, so there is
+	// no need to cache them
+	if isWellKnownSite(importpath) {
+		return resolveRepoRootUncached(importpath)
+	}
+
+	repoRoots.Lock()
+	if repoRoots.cache == nil {
+		repoRoots.cache = loadRepoRootsCache()
+	}
+
+	cached, ok := repoRoots.cache[importpath]
+	repoRoots.Unlock()
+
+	if ok && (offline || time.Since(cached.Resolved) < cacheTTL) {
+		return cached.repoRoot, nil
+	}
+
+	if offline {
+		return resolveRepoRootOffline(importpath)
+	}
+
+	root, err := resolveRepoRootUncached(importpath)
+	if err != nil {
+		return root, err
+	}
+
+	repoRoots.Lock()
+	defer repoRoots.Unlock()
+
+	repoRoots.cache[importpath] = cachedRepoRoot{
+		repoRoot: root,
+		Resolved: time.Now(),
+	}
+
+	err = saveRepoRootsCache(repoRoots.cache)
+	if err != nil {
+		logger.Warning(err)
+	}
+
+	return root, nil
+}
+
+func isWellKnownSite(importpath string) bool {
+	for site := range wellKnownSites {
+		if strings.HasPrefix(importpath, site) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveRepoRootOffline resolves repository root without network access
+// using well-known sites and URLs of vendor submodules from .gitmodules.
+func resolveRepoRootOffline(importpath string) (repoRoot, error) {
+	gitmodules, err := getVendorGitmodules()
+	if err != nil {
+		return repoRoot{}, err
+	}
+
+	var root repoRoot
+	for path, section := range gitmodules {
+		if hasPathPrefix(importpath, path) && len(path) > len(root.Importpath) {
+			root = repoRoot{
+				Importpath: path,
+				VCS:        "git",
+				URL:        section.URL,
+			}
+		}
+	}
+
+	if root.Importpath == "" {
+		return root, fmt.Errorf(
+			"unable to resolve repository root of %s in offline mode, "+
+				"it's neither cached nor vendored",
+			importpath,
+		)
+	}
+
+	return root, nil
+}
+
+func resolveRepoRootUncached(importpath string) (repoRoot, error) {
+	for site, elements := range wellKnownSites {
+		if !strings.HasPrefix(importpath, site) {
+			continue
+		}
+
+		parts := strings.Split(importpath, "/")
+		if len(parts) < elements {
+			return repoRoot{}, fmt.Errorf(
+				"invalid import path for %s: %s", site, importpath,
+			)
+		}
+
+		root := strings.Join(parts[:elements], "/")
+
+		return repoRoot{
+			Importpath: root,
+			VCS:        "git",
+			URL:        "https://" + root,
+		}, nil
+	}
+
+	for path := importpath; strings.Contains(path, "/"); path = parentPath(path) {
+		root, found, err := resolveRepoRootByMeta(importpath, path)
+		if err != nil {
+			return repoRoot{}, karma.Format(
+				err, "unable to resolve repository root of %s", importpath,
+			)
+		}
+
+		if found {
+			return root, nil
+		}
+	}
+
+	// there is no go-import meta, so the only guess is that import path
+	// itself is an URL of git repository.
+	return repoRoot{
+		Importpath: importpath,
+		VCS:        "git",
+		URL:        "https://" + importpath,
+	}, nil
+}
+
+// resolveRepoRootByMeta requests page for given path and looks for meta
+// tags which describe repository of given import path.
+func resolveRepoRootByMeta(importpath, path string) (repoRoot, bool, error) {
+	url := "https://" + path + "?go-get=1"
+
+	response, err := httpGet(url)
+	if err != nil {
+		return repoRoot{}, false, err
+	}
+
+	defer response.Body.Close()
+
+	if location := response.Request.URL.String(); location != url {
+		logger.Debugf("%s redirected to %s", url, location)
+	}
+
+	// NOTE: go get accepts meta tags from pages with any status code, so
+	// do we.
+	doc, err := goquery.NewDocumentFromReader(response.Body)
+	if err != nil {
+		return repoRoot{}, false, karma.Format(
+			err, "unable to parse %s", url,
+		)
+	}
+
+	imports, err := parseMetaImports(doc, url)
+	if err != nil {
+		return repoRoot{}, false, err
+	}
+
+	var match *metaImport
+	for i, meta := range imports {
+		if !hasPathPrefix(importpath, meta.Prefix) {
+			continue
+		}
+
+		// mod vcs points to module proxy, it's used only when there is no
+		// real repository
+		if match == nil ||
+			len(meta.Prefix) > len(match.Prefix) ||
+			len(meta.Prefix) == len(match.Prefix) && match.VCS == "mod" {
+			match = &imports[i]
+		}
+	}
+
+	prefix, home := parseMetaSource(doc, importpath)
+
+	if match == nil || match.VCS == "mod" {
+		if home == "" {
+			return repoRoot{}, false, nil
+		}
+
+		// go-source meta is the last resort, it points to home page of
+		// repository which usually can be cloned.
+		return repoRoot{
+			Importpath: prefix,
+			VCS:        "git",
+			URL:        home,
+			Home:       home,
+		}, true, nil
+	}
+
+	return repoRoot{
+		Importpath: match.Prefix,
+		VCS:        match.VCS,
+		URL:        match.URL,
+		Home:       home,
+	}, true, nil
+}
+
+func parseMetaImports(doc *goquery.Document, url string) ([]metaImport, error) {
+	var (
+		imports []metaImport
+		err     error
+	)
+
+	doc.Find(tagMetaGoImport).Each(func(_ int, selection *goquery.Selection) {
+		if err != nil {
+			return
+		}
+
+		content, ok := selection.Attr("content")
+		if !ok {
+			err = fmt.Errorf(
+				`"content" attribute not found in `+
+					`meta name="go-import" at %s`,
+				url,
+			)
+			return
+		}
+
+		terms := strings.Fields(content)
+		if len(terms) != 3 {
+			err = fmt.Errorf(
+				`invalid formatted "content" attribute in `+
+					`meta name="go-import" at %s`, url,
+			)
+			return
+		}
+
+		imports = append(imports, metaImport{
+			Prefix: terms[0],
+			VCS:    terms[1],
+			URL:    terms[2],
+		})
+	})
+
+	return imports, err
+}
+
+// parseMetaSource returns prefix and home URL from go-source meta which
+// prefix matches given import path:
+// <meta name="go-source" content="prefix home directory file">
+func parseMetaSource(doc *goquery.Document, importpath string) (string, string) {
+	var prefix, home string
+
+	doc.Find(tagMetaGoSource).Each(func(_ int, selection *goquery.Selection) {
+		content, _ := selection.Attr("content")
+
+		terms := strings.Fields(content)
+		if len(terms) < 2 || !hasPathPrefix(importpath, terms[0]) {
+			return
+		}
+
+		if strings.HasPrefix(terms[1], "https://") {
+			prefix, home = terms[0], terms[1]
+		}
+	})
+
+	return prefix, home
+}
+
+// getHttpsURLForImportPath returns URL of git repository of given import
+// path, *unsupportedVCSError is returned for repositories of other VCS.
+func getHttpsURLForImportPath(importpath string) (string, error) {
+	root, err := resolveRepoRoot(importpath)
+	if err != nil {
+		return "", err
+	}
+
+	if root.VCS != "git" {
+		return "", &unsupportedVCSError{
+			Importpath: importpath,
+			VCS:        root.VCS,
+			URL:        root.URL,
+		}
+	}
+
+	return root.URL, nil
+}
+
+func hasPathPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+func parentPath(path string) string {
+	index := strings.LastIndex(path, "/")
+	if index < 0 {
+		return ""
+	}
+
+	return path[:index]
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var reSemver = regexp.MustCompile(
+	`^v([0-9]+)\.([0-9]+)\.([0-9]+)(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`,
+)
+
+type semver struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+}
+
+func parseSemver(version string) (semver, bool) {
+	matches := reSemver.FindStringSubmatch(version)
+	if matches == nil {
+		return semver{}, false
+	}
+
+	var result semver
+	result.Major, _ = strconv.Atoi(matches[1])
+	result.Minor, _ = strconv.Atoi(matches[2])
+	result.Patch, _ = strconv.Atoi(matches[3])
+	result.Prerelease = matches[4]
+
+	return result, true
+}
+
+func (version semver) String() string {
+	result := fmt.Sprintf(
+		"v%d.%d.%d", version.Major, version.Minor, version.Patch,
+	)
+	if version.Prerelease != "" {
+		result += "-" + version.Prerelease
+	}
+
+	return result
+}
+
+// Less reports whether version has lower precedence than other according to
+// semver specification.
+func (version semver) Less(other semver) bool {
+	if version.Major != other.Major {
+		return version.Major < other.Major
+	}
+
+	if version.Minor != other.Minor {
+		return version.Minor < other.Minor
+	}
+
+	if version.Patch != other.Patch {
+		return version.Patch < other.Patch
+	}
+
+	switch {
+	case version.Prerelease == other.Prerelease:
+		return false
+	case version.Prerelease == "":
+		return false
+	case other.Prerelease == "":
+		return true
+	}
+
+	var (
+		identifiers      = strings.Split(version.Prerelease, ".")
+		otherIdentifiers = strings.Split(other.Prerelease, ".")
+	)
+
+	for i := 0; i < len(identifiers) && i < len(otherIdentifiers); i++ {
+		if identifiers[i] == otherIdentifiers[i] {
+			continue
+		}
+
+		number, err := strconv.Atoi(identifiers[i])
+		otherNumber, otherErr := strconv.Atoi(otherIdentifiers[i])
+
+		switch {
+		case err == nil && otherErr == nil:
+			return number < otherNumber
+		case err == nil:
+			return true
+		case otherErr == nil:
+			return false
+		default:
+			return identifiers[i] < otherIdentifiers[i]
+		}
+	}
+
+	return len(identifiers) < len(otherIdentifiers)
+}
+
+// parseSemverConstraint parses constraint like ^1.4, ~1.4.2, >=1.2 <2,
+// 1.4.x or v1.4.2 and returns function which reports whether version
+// satisfies it. Pre-release versions satisfy constraint only when constraint
+// mentions pre-release explicitly.
+func parseSemverConstraint(constraint string) (func(semver) bool, error) {
+	var (
+		conditions []func(semver) bool
+		prerelease = strings.Contains(constraint, "-")
+	)
+
+	for _, term := range strings.FieldsFunc(
+		constraint,
+		func(char rune) bool { return char == ',' || char == ' ' },
+	) {
+		operator := term[:len(term)-len(strings.TrimLeft(term, "^~<>="))]
+
+		bound, parts, err := parsePartialSemver(term[len(operator):])
+		if err != nil {
+			return nil, err
+		}
+
+		condition, err := getSemverCondition(operator, bound, parts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid constraint %q: %s", term, err)
+		}
+
+		conditions = append(conditions, condition)
+	}
+
+	return func(version semver) bool {
+		if version.Prerelease != "" && !prerelease {
+			return false
+		}
+
+		for _, condition := range conditions {
+			if !condition(version) {
+				return false
+			}
+		}
+
+		return true
+	}, nil
+}
+
+// parsePartialSemver parses version which can omit minor and patch numbers
+// or specify them as x or *, returns number of specified parts.
+func parsePartialSemver(version string) (semver, int, error) {
+	var (
+		result semver
+		parts  int
+	)
+
+	version = strings.TrimPrefix(version, "v")
+
+	if index := strings.Index(version, "-"); index >= 0 {
+		result.Prerelease = version[index+1:]
+		version = version[:index]
+	}
+
+	if version == "" || version == "*" || version == "x" || version == "X" {
+		return result, 0, nil
+	}
+
+	numbers := []*int{&result.Major, &result.Minor, &result.Patch}
+	for i, part := range strings.Split(version, ".") {
+		if i >= len(numbers) {
+			return result, 0, fmt.Errorf("invalid version: %s", version)
+		}
+
+		if part == "x" || part == "X" || part == "*" {
+			break
+		}
+
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return result, 0, fmt.Errorf("invalid version: %s", version)
+		}
+
+		*numbers[i] = number
+		parts++
+	}
+
+	return result, parts, nil
+}
+
+func getSemverCondition(
+	operator string,
+	bound semver,
+	parts int,
+) (func(semver) bool, error) {
+	// upper is the first version which doesn't match partial version, e.g.
+	// v1.5.0 for 1.4 and v2.0.0 for 1.
+	upper := bound
+	switch parts {
+	case 0:
+		upper = semver{Major: 1 << 30}
+	case 1:
+		upper = semver{Major: bound.Major + 1}
+	case 2:
+		upper = semver{Major: bound.Major, Minor: bound.Minor + 1}
+	}
+
+	atLeast := func(limit semver) func(semver) bool {
+		return func(version semver) bool { return !version.Less(limit) }
+	}
+
+	below := func(limit semver) func(semver) bool {
+		return func(version semver) bool { return version.Less(limit) }
+	}
+
+	switch operator {
+	case "", "=":
+		if parts == 3 {
+			return func(version semver) bool {
+				return version == bound
+			}, nil
+		}
+
+		return both(atLeast(bound), below(upper)), nil
+
+	case "^":
+		switch {
+		case bound.Major > 0 || parts < 2:
+			upper = semver{Major: bound.Major + 1}
+		case bound.Minor > 0 || parts < 3:
+			upper = semver{Minor: bound.Minor + 1}
+		default:
+			upper = semver{Patch: bound.Patch + 1}
+		}
+
+		return both(atLeast(bound), below(upper)), nil
+
+	case "~":
+		if parts == 3 {
+			upper = semver{Major: bound.Major, Minor: bound.Minor + 1}
+		}
+
+		return both(atLeast(bound), below(upper)), nil
+
+	case ">=":
+		return atLeast(bound), nil
+
+	case ">":
+		if parts < 3 {
+			return atLeast(upper), nil
+		}
+
+		return func(version semver) bool { return bound.Less(version) }, nil
+
+	case "<=":
+		if parts < 3 {
+			return below(upper), nil
+		}
+
+		return func(version semver) bool { return !bound.Less(version) }, nil
+
+	case "<":
+		return below(bound), nil
+	}
+
+	return nil, fmt.Errorf("unknown operator %q", operator)
+}
+
+func both(first, second func(semver) bool) func(semver) bool {
+	return func(version semver) bool {
+		return first(version) && second(version)
+	}
+}
@@ -1,29 +1,70 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"go/build"
+	"io/ioutil"
+	"net/http"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/PuerkitoBio/goquery"
 	"github.com/reconquest/karma-go"
 )
 
-const tagMetaGoImport = "meta[name=go-import]"
+// indexMutex serializes changes of .gitmodules and index of main repository
+// made by concurrent workers.
+var indexMutex = sync.Mutex{}
 
-// NOTE: This list is copied from
-// https://github.com/golang/go/blob/10538a8f9e2e718a47633ac5a6e90415a2c3f5f1/src/cmd/go/vcs.go#L821-L861
-var wellKnownSites = []string{
-	"github.com/",
-	"bitbucket.org/",
-	"hub.jazz.net/git/",
-	"git.apache.org/",
-	"git.openstack.org/",
+// getGitmodulesPath returns path of .gitmodules of repository, which is
+// located in top-level directory even if manul works in subdirectory.
+func getGitmodulesPath() string {
+	return filepath.Join(toplevel, ".gitmodules")
+}
+
+// getVendorPath returns path of vendor submodule for given import path
+// relative to project directory.
+func getVendorPath(importpath string) string {
+	return vendorDir + "/" + importpath
+}
+
+// getVendorModulesDir returns directory in .git/modules where git
+// directories of vendor submodules are stored.
+func getVendorModulesDir() string {
+	return filepath.Join(toplevel, ".git", "modules", getToplevelPath(vendorDir))
 }
 
 func getVendorSubmodules() (map[string]string, error) {
+	statuses, err := getVendorSubmodulesStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	vendors := map[string]string{}
+	for path, status := range statuses {
+		if status.State == '+' || status.State == 'U' {
+			vendors[path] = string(status.State) + status.Commit
+		} else {
+			vendors[path] = status.Commit
+		}
+	}
+
+	return vendors, nil
+}
+
+// submoduleStatus is a line of git submodule status output, State is one of
+// ' ' (checked out at recorded commit), '-' (not initialized), '+' (checked
+// out commit differs from recorded one) and 'U' (merge conflicts).
+type submoduleStatus struct {
+	Commit string
+	State  byte
+}
+
+func getVendorSubmodulesStatus() (map[string]submoduleStatus, error) {
 	output, err := execute(
 		exec.Command("git", "submodule", "status"),
 	)
@@ -33,7 +74,7 @@ func getVendorSubmodules() (map[string]string, error) {
 		)
 	}
 
-	vendors := map[string]string{}
+	vendors := map[string]submoduleStatus{}
 
 	lines := strings.Split(output, "\n")
 	for _, line := range lines {
@@ -41,13 +82,16 @@ func getVendorSubmodules() (map[string]string, error) {
 			continue
 		}
 
-		parts := strings.Split(strings.TrimLeft(line, " -"), " ")
+		parts := strings.Split(strings.TrimLeft(line[1:], " "), " ")
 		if len(parts) >= 2 {
 			path := parts[1]
 			commit := parts[0]
-			if strings.HasPrefix(path, "vendor/") {
-				path = strings.TrimPrefix(path, "vendor/")
-				vendors[path] = commit
+			if strings.HasPrefix(path, vendorDir+"/") {
+				path = strings.TrimPrefix(path, vendorDir+"/")
+				vendors[path] = submoduleStatus{
+					Commit: commit,
+					State:  line[0],
+				}
 			}
 		}
 	}
@@ -55,9 +99,158 @@ func getVendorSubmodules() (map[string]string, error) {
 	return vendors, nil
 }
 
+// isVendorSubmoduleInitialized reports whether vendor submodule is checked
+// out. Directory of uninitialized submodule is empty, so git commands run in
+// it operate on main repository instead.
+func isVendorSubmoduleInitialized(importpath string) bool {
+	cwd := filepath.Join(workdir, getVendorPath(importpath))
+
+	output, err := executeStdout(
+		exec.Command("git", "-C", cwd, "rev-parse", "--show-toplevel"),
+	)
+	if err != nil {
+		return false
+	}
+
+	top, err := os.Stat(strings.TrimSpace(output))
+	if err != nil {
+		return false
+	}
+
+	dir, err := os.Stat(cwd)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(top, dir)
+}
+
+// ensureVendorSubmoduleInitialized returns error if vendor submodule is not
+// checked out, so git commands are never run in its empty directory.
+func ensureVendorSubmoduleInitialized(importpath string) error {
+	if isVendorSubmoduleInitialized(importpath) {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"vendor submodule %s is not initialized, "+
+			"run git submodule update --init %s",
+		importpath, getVendorPath(importpath),
+	)
+}
+
+// gitmodule is a section of .gitmodules file.
+type gitmodule struct {
+	Name   string
+	Path   string
+	URL    string
+	Branch string
+}
+
+// getVendorGitmodules returns sections of .gitmodules which describe vendor
+// submodules by their import paths.
+func getVendorGitmodules() (map[string]gitmodule, error) {
+	gitmodules := map[string]gitmodule{}
+
+	if _, err := os.Stat(getGitmodulesPath()); err != nil {
+		if os.IsNotExist(err) {
+			return gitmodules, nil
+		}
+
+		return nil, err
+	}
+
+	output, err := executeStdout(
+		exec.Command(
+			"git", "config", "-f", getGitmodulesPath(),
+			"--get-regexp", `^submodule\..*\.(path|url|branch)$`,
+		),
+	)
+	if err != nil {
+		return nil, karma.Format(
+			err, "unable to read .gitmodules",
+		)
+	}
+
+	sections := map[string]*gitmodule{}
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		key, value := fields[0], fields[1]
+
+		index := strings.LastIndex(key, ".")
+		name := strings.TrimPrefix(key[:index], "submodule.")
+
+		section, ok := sections[name]
+		if !ok {
+			section = &gitmodule{Name: name}
+			sections[name] = section
+		}
+
+		switch key[index+1:] {
+		case "path":
+			section.Path = value
+		case "url":
+			section.URL = value
+		case "branch":
+			section.Branch = value
+		}
+	}
+
+	// paths in .gitmodules are relative to top-level directory
+	prefix := getToplevelPath(vendorDir) + "/"
+	for _, section := range sections {
+		if strings.HasPrefix(section.Path, prefix) {
+			gitmodules[strings.TrimPrefix(section.Path, prefix)] = *section
+		}
+	}
+
+	return gitmodules, nil
+}
+
+// getVendorSubmodulesURLs returns remote URLs of vendor submodules recorded
+// in .gitmodules.
+func getVendorSubmodulesURLs() (map[string]string, error) {
+	gitmodules, err := getVendorGitmodules()
+	if err != nil {
+		return nil, err
+	}
+
+	urls := map[string]string{}
+	for importpath, section := range gitmodules {
+		urls[importpath] = section.URL
+	}
+
+	return urls, nil
+}
+
+// addVendorSubmodule clones given dependency into vendor directory and
+// registers it as submodule.
 func addVendorSubmodule(importpath string, version string) []error {
+	url, errs := cloneVendorSubmodule(importpath, version)
+	if errs != nil {
+		return errs
+	}
+
+	err := registerVendorSubmodule(importpath, url)
+	if err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// cloneVendorSubmodule clones repository of given dependency into vendor
+// directory trying different URL schemes and returns URL that worked. It
+// doesn't touch .gitmodules and index, so it's safe to run concurrently.
+func cloneVendorSubmodule(importpath string, version string) (string, []error) {
 	var (
-		target   = "vendor/" + importpath
+		target   = getVendorPath(importpath)
+		repo     = getRepoImportpath(importpath)
 		prefixes = []string{
 			"https://",
 			"git+ssh://",
@@ -67,152 +260,1055 @@ func addVendorSubmodule(importpath string, version string) []error {
 		errs []error
 	)
 
+	recordCreatedDir(filepath.Join(workdir, vendorDir), importpath)
+
+	if useProxy && !offline {
+		origin, err := resolveProxyOrigin(importpath, version)
+		if err == nil {
+			return cloneProxyOrigin(importpath, origin)
+		}
+
+		logger.Debugf(
+			"unable to resolve %s using GOPROXY, "+
+				"falling back to direct resolution: %s",
+			importpath, err,
+		)
+	}
+
+	root, err := resolveRepoRoot(repo)
+	if err != nil {
+		if offline {
+			return "", []error{err}
+		}
+
+		errs = append(errs, err)
+	} else {
+		repo = root.Importpath
+	}
+
+	rules, err := getRewriteRules()
+	if err != nil {
+		return "", []error{err}
+	}
+
+	if url, ok := rewriteURL(rules, repo); ok {
+		logger.Debugf("using rewritten URL %s for %s", url, importpath)
+
+		err := cloneVendorRepository(url, target, version)
+		if err != nil {
+			return "", []error{err}
+		}
+
+		return url, nil
+	}
+
 	for _, prefix := range prefixes {
 		var url string
 		if prefix == "https://" {
+			if root.URL == "" {
+				continue
+			}
+
 			var err error
-			url, err = getHttpsURLForImportPath(importpath)
+			url, err = getHttpsURLForImportPath(repo)
+			if unsupported, ok := err.(*unsupportedVCSError); ok {
+				// there is no sense to try other schemes, the repository
+				// can't be cloned by plain git
+				if !convertVCS {
+					return "", []error{unsupported}
+				}
+
+				url, err = unsupported.getRemoteHelperURL()
+				if err != nil {
+					return "", []error{err}
+				}
+
+				logger.Infof(
+					"converting %s repository %s into git using %s",
+					unsupported.getName(), unsupported.URL, url,
+				)
+
+				err = cloneVendorRepository(url, target, version)
+				if err != nil {
+					return "", []error{err}
+				}
+
+				return url, nil
+			}
+
 			if err != nil {
 				errs = append(errs, err)
 				continue
 			}
 		} else {
-			url = prefix + importpath
+			url = prefix + repo
 		}
 
-		_, err := execute(
-			exec.Command("git", "submodule", "add", "-f", url, target),
-		)
+		err := cloneVendorRepository(url, target, version)
 		if err == nil {
-			if version != "" {
-				_, err = execute(
-					exec.Command("git", "-C", target, "checkout", version),
-				)
-				if err != nil {
-					return []error{err}
-				}
-			}
+			return url, nil
+		}
 
-			return nil
+		// checkout failure means that repository is found, but version
+		// is not, so other schemes will fail the same way
+		if _, ok := err.(*cloneError); !ok {
+			return "", []error{err}
 		}
 
 		errs = append(errs, err)
 	}
 
-	return errs
+	return "", errs
 }
 
-func getHttpsURLForImportPath(importpath string) (url string, err error) {
-	url = "https://" + importpath
-	for _, site := range wellKnownSites {
-		if strings.HasPrefix(importpath, site) {
-			return url, nil
+// cloneError describes failed attempt to clone repository by given URL.
+type cloneError struct {
+	URL    string
+	Reason string
+}
+
+func (err *cloneError) Error() string {
+	return err.URL + ": " + err.Reason
+}
+
+// clonedDirs contains vendor directories created by clones of this run,
+// only they are removed if clone or submodule registration fails, existing
+// directories belong to user.
+var clonedDirs = struct {
+	sync.Mutex
+	targets map[string]bool
+}{
+	targets: map[string]bool{},
+}
+
+// cloneVendorRepository clones repository into target directory and checks
+// out given version. If anything fails, target directory is removed, so the
+// next attempt starts from scratch. Target directory is never removed if it
+// existed before clone.
+func cloneVendorRepository(url string, target string, version string) error {
+	created, err := isNewCloneTarget(target)
+	if err != nil {
+		return err
+	}
+
+	output, err := executeChange(exec.Command("git", "clone", url, target))
+	if err != nil {
+		logger.Debugf("unable to clone %s: %s", url, err)
+
+		if created {
+			removeClonedRepository(target)
 		}
+
+		return &cloneError{
+			URL:    url,
+			Reason: diagnoseCloneFailure(url, output),
+		}
+	}
+
+	if created {
+		clonedDirs.Lock()
+		clonedDirs.targets[target] = true
+		clonedDirs.Unlock()
 	}
 
-	// NOTE: Parse <meta name="go-import" content="import-prefix vcs repo-root">
-	// For detail, see the output of "go help importpath"
-	var doc *goquery.Document
-	doc, err = goquery.NewDocument(url + "?go-get=1")
+	err = checkoutVendorSubmodule(target, version)
 	if err != nil {
-		return "", err
+		if created {
+			removeClonedRepository(target)
+		}
+
+		return karma.Format(
+			err, "unable to checkout %s of %s", version, url,
+		)
 	}
 
-	doc.Find(tagMetaGoImport).Each(func(_ int, selection *goquery.Selection) {
-		if err != nil {
-			return
+	return nil
+}
+
+// isNewCloneTarget returns true if target directory doesn't exist, so it's
+// created by clone. Existing empty directory can be cloned into, but other
+// existing directories, like vendor trees created by go mod vendor, are
+// reported as error instead of being overwritten.
+func isNewCloneTarget(target string) (bool, error) {
+	path := filepath.Join(workdir, target)
+
+	files, err := ioutil.ReadDir(path)
+	switch {
+	case os.IsNotExist(err):
+		return true, nil
+
+	case err != nil:
+		return false, karma.Format(err, "unable to read %s", target)
+
+	case len(files) > 0:
+		return false, fmt.Errorf(
+			"%s already exists and is not empty, remove it to vendor "+
+				"the dependency as submodule",
+			target,
+		)
+	}
+
+	return false, nil
+}
+
+func removeClonedRepository(target string) {
+	clonedDirs.Lock()
+	delete(clonedDirs.targets, target)
+	clonedDirs.Unlock()
+
+	if dryRun {
+		return
+	}
+
+	err := os.RemoveAll(filepath.Join(workdir, target))
+	if err != nil {
+		logger.Warning(karma.Format(err, "unable to remove %s", target))
+	}
+}
+
+// diagnoseCloneFailure returns short human-readable reason of failed clone
+// using output of git clone.
+func diagnoseCloneFailure(url string, output string) string {
+	lower := strings.ToLower(output)
+
+	contains := func(substrings ...string) bool {
+		for _, substring := range substrings {
+			if strings.Contains(lower, substring) {
+				return true
+			}
 		}
 
-		content, ok := selection.Attr("content")
-		if !ok {
-			err = fmt.Errorf(
-				`"content" attribute not found in `+
-					`meta name="go-import" at %s`,
-				url,
-			)
-			return
+		return false
+	}
+
+	switch {
+	case contains(
+		"could not resolve host",
+		"name or service not known",
+		"temporary failure in name resolution",
+		"nodename nor servname",
+	):
+		return "host is not resolvable (DNS failure)"
+
+	case contains(
+		"authentication failed",
+		"could not read username",
+		"could not read password",
+		"terminal prompts disabled",
+		"permission denied",
+		"returned error: 401",
+		"returned error: 403",
+		"host key verification failed",
+	):
+		return "authentication failed"
+
+	case contains(
+		"repository not found",
+		"not found",
+		"does not appear to be a git repository",
+		"does not exist",
+		"returned error: 404",
+	):
+		return "repository not found"
+
+	case contains(
+		"connection refused",
+		"connection timed out",
+		"operation timed out",
+		"network is unreachable",
+		"no route to host",
+	):
+		return "connection failed"
+
+	case contains("certificate", "ssl"):
+		return "TLS verification failed"
+	}
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if line := strings.TrimSpace(lines[len(lines)-1]); line != "" {
+		return line
+	}
+
+	return "clone failed"
+}
+
+// cleanupVendorSubmodule removes everything failed submodule registration
+// could leave: index entry, .gitmodules and .git/config sections, git
+// directory if it's created by registration and working tree if it's created
+// by clone. It modifies .gitmodules and index, so calls must be serialized.
+func cleanupVendorSubmodule(importpath string, removeModule bool) {
+	var (
+		target = getVendorPath(importpath)
+		name   = getToplevelPath(target)
+	)
+
+	logger.Debugf("cleaning up failed submodule %s", target)
+
+	for _, args := range [][]string{
+		{"rm", "-q", "--cached", "--ignore-unmatch", "--", target},
+		{"config", "-f", getGitmodulesPath(), "--remove-section", "submodule." + name},
+		{"config", "--remove-section", "submodule." + name},
+	} {
+		// sections can be missing, so errors are expected
+		_, err := executeChange(exec.Command("git", args...))
+		if err != nil {
+			logger.Tracef("%s", err)
 		}
+	}
 
-		terms := strings.Fields(content)
-		if len(terms) != 3 {
-			err = fmt.Errorf(
-				`invalid formatted "content" attribute in `+
-					`meta name="go-import" at %s`, url,
-			)
-			return
+	if dryRun {
+		return
+	}
+
+	// .gitmodules without sections is left empty by git config
+	gitmodules := getGitmodulesPath()
+	if info, err := os.Stat(gitmodules); err == nil && info.Size() == 0 {
+		_, err = execute(exec.Command(
+			"git", "rm", "-q", "-f", "--cached", "--ignore-unmatch",
+			gitmodules,
+		))
+		if err == nil {
+			os.Remove(gitmodules)
 		}
+	}
 
-		var (
-			prefix   = terms[0]
-			vcs      = terms[1]
-			repoRoot = terms[2]
-		)
+	clonedDirs.Lock()
+	cloned := clonedDirs.targets[target]
+	delete(clonedDirs.targets, target)
+	clonedDirs.Unlock()
 
-		if strings.HasPrefix(importpath, prefix) && vcs == "git" {
-			url = repoRoot
+	var roots []string
+	if cloned {
+		roots = append(roots, filepath.Join(workdir, vendorDir))
+	}
+
+	if removeModule {
+		roots = append(roots, getVendorModulesDir())
+	}
+
+	for _, root := range roots {
+		path := filepath.Join(root, importpath)
+
+		err := os.RemoveAll(path)
+		if err != nil {
+			logger.Warning(karma.Format(err, "unable to remove %s", path))
 		}
-	})
 
-	return url, err
+		removeEmptyParents(root, importpath)
+	}
 }
 
-func removeVendorSubmodule(importpath string) error {
-	vendor := "vendor/" + importpath
+// checkoutVendorSubmodule checks out given commit-ish or module version in
+// cloned repository.
+func checkoutVendorSubmodule(target string, version string) error {
+	if version == "" {
+		return nil
+	}
 
-	_, err := execute(
-		exec.Command("git", "submodule", "deinit", "-f", vendor),
+	_, err := executeChange(
+		exec.Command(
+			"git", "-C", target, "checkout", getModuleRevision(version),
+		),
 	)
-	if err != nil {
-		return karma.Format(
-			err, "unable to deinit vendor submodule: %s", vendor,
-		)
+	return err
+}
+
+// proxyOrigin is a version info returned by GOPROXY, Origin is recorded by
+// proxy when module version is fetched from VCS.
+type proxyOrigin struct {
+	Version string
+	Time    time.Time
+	Origin  *struct {
+		VCS    string
+		URL    string
+		Subdir string
+		Hash   string
+		Ref    string
 	}
+}
 
-	_, err = execute(
-		exec.Command("git", "rm", "--force", vendor),
-	)
+// resolveProxyOrigin asks module proxies from GOPROXY about repository and
+// commit of given module version, the latest version from @v/list is used
+// if version is not specified.
+func resolveProxyOrigin(module string, version string) (proxyOrigin, error) {
+	output, err := execute(exec.Command("go", "env", "GOPROXY"))
 	if err != nil {
-		return karma.Format(
-			err, "unable to remove vendor directory: %s", vendor,
+		return proxyOrigin{}, karma.Format(
+			err, "unable to get GOPROXY",
 		)
 	}
 
-	_, err = execute(
-		exec.Command("rm", "-r", filepath.Join(".git", "modules", vendor)),
-	)
+	escaped, err := escapeModulePath(module)
 	if err != nil {
-		return karma.Format(
-			err, "unable to remove .git/modules/%s directory", vendor,
-		)
+		return proxyOrigin{}, err
 	}
 
-	return nil
+	var errs []error
+	for _, proxy := range strings.FieldsFunc(
+		strings.TrimSpace(output),
+		func(char rune) bool { return char == ',' || char == '|' },
+	) {
+		if proxy == "direct" || proxy == "off" {
+			continue
+		}
+
+		base := strings.TrimSuffix(proxy, "/") + "/" + escaped + "/@v/"
+
+		origin, err := getProxyOrigin(base, version)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		return origin, nil
+	}
+
+	if len(errs) == 0 {
+		return proxyOrigin{}, fmt.Errorf("no module proxies in GOPROXY")
+	}
+
+	return proxyOrigin{}, karma.Push(
+		fmt.Errorf("unable to resolve %s using GOPROXY", module),
+		errorsToReasons(errs)...,
+	)
 }
 
-func updateVendorSubmodule(importpath string, version string) error {
-	cwd := filepath.Join(workdir, "vendor", importpath)
+func getProxyOrigin(base string, version string) (proxyOrigin, error) {
+	var origin proxyOrigin
+
 	if version == "" {
-		cmd := exec.Command(
-			"git", "-C", cwd, "pull", "origin", "master")
+		list, err := readProxyFile(base + "list")
+		if err != nil {
+			return origin, err
+		}
 
-		_, err := execute(cmd)
-		return err
+		latest, ok := getLatestProxyVersion(strings.Fields(string(list)))
+		if !ok {
+			return origin, fmt.Errorf("no versions at %slist", base)
+		}
+
+		version = latest
 	}
 
-	_, err := execute(exec.Command("git", "-C", cwd, "show", version))
+	info, err := readProxyFile(base + version + ".info")
 	if err != nil {
-		_, err := execute(exec.Command("git", "-C", cwd, "remote", "update"))
-		if err != nil {
-			return err
-		}
+		return origin, err
 	}
 
-	_, err = execute(
-		exec.Command("git", "-C", cwd, "checkout", version),
-	)
+	err = json.Unmarshal(info, &origin)
+	if err != nil {
+		return origin, karma.Format(
+			err, "unable to decode %s%s.info", base, version,
+		)
+	}
+
+	switch {
+	case origin.Origin == nil:
+		return origin, fmt.Errorf(
+			"%s%s.info doesn't contain origin", base, version,
+		)
+
+	case origin.Origin.VCS != "git":
+		return origin, fmt.Errorf(
+			"%s%s.info points to %s repository",
+			base, version, origin.Origin.VCS,
+		)
+
+	case origin.Origin.Subdir != "":
+		return origin, fmt.Errorf(
+			"module is located in subdirectory %s of repository %s, "+
+				"it can't be vendored as submodule",
+			origin.Origin.Subdir, origin.Origin.URL,
+		)
+
+	case origin.Origin.Hash == "":
+		return origin, fmt.Errorf(
+			"%s%s.info doesn't contain commit hash", base, version,
+		)
+	}
+
+	return origin, nil
+}
+
+// getLatestProxyVersion returns the latest version from @v/list exactly as
+// it's listed, so suffixes like +incompatible are kept. Prereleases are used
+// only if there are no releases, the same way as go does.
+func getLatestProxyVersion(versions []string) (string, bool) {
+	for _, prerelease := range []bool{false, true} {
+		var (
+			latest        string
+			latestVersion semver
+		)
+
+		for _, item := range versions {
+			version, ok := parseSemver(item)
+			if !ok || (version.Prerelease != "") != prerelease {
+				continue
+			}
+
+			if latest == "" || latestVersion.Less(version) {
+				latest = item
+				latestVersion = version
+			}
+		}
+
+		if latest != "" {
+			return latest, true
+		}
+	}
+
+	return "", false
+}
+
+// readProxyFile reads file from module proxy, file:// proxies are
+// supported as well as http(s) ones.
+func readProxyFile(url string) ([]byte, error) {
+	if strings.HasPrefix(url, "file://") {
+		contents, err := ioutil.ReadFile(strings.TrimPrefix(url, "file://"))
+		if err != nil {
+			return nil, karma.Format(err, "unable to read %s", url)
+		}
+
+		return contents, nil
+	}
+
+	response, err := httpGet(url)
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, response.Status)
+	}
+
+	contents, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, karma.Format(err, "unable to read %s", url)
+	}
+
+	return contents, nil
+}
+
+// cloneProxyOrigin clones repository recorded by module proxy and checks out
+// exact commit recorded by proxy.
+func cloneProxyOrigin(importpath string, origin proxyOrigin) (string, []error) {
+	var (
+		target = getVendorPath(importpath)
+		url    = origin.Origin.URL
+	)
+
+	rules, err := getRewriteRules()
+	if err != nil {
+		return "", []error{err}
+	}
+
+	repo := strings.TrimSuffix(
+		strings.TrimPrefix(
+			strings.TrimPrefix(url, "https://"), "http://",
+		),
+		".git",
+	)
+	if rewritten, ok := rewriteURL(rules, repo); ok {
+		url = rewritten
+	}
+
+	logger.Infof(
+		"using %s at %s recorded by GOPROXY for %s %s",
+		url, origin.Origin.Hash, importpath, origin.Version,
+	)
+
+	err = cloneVendorRepository(url, target, origin.Origin.Hash)
+	if err != nil {
+		return "", []error{err}
+	}
+
+	return url, nil
+}
+
+// escapeModulePath escapes upper-case letters of module path as required
+// by module proxy protocol: github.com/Foo becomes github.com/!foo.
+func escapeModulePath(module string) (string, error) {
+	var escaped strings.Builder
+	for _, char := range module {
+		if char == '!' {
+			return "", fmt.Errorf("invalid module path: %s", module)
+		}
+
+		if char >= 'A' && char <= 'Z' {
+			escaped.WriteRune('!')
+			char += 'a' - 'A'
+		}
+
+		escaped.WriteRune(char)
+	}
+
+	return escaped.String(), nil
+}
+
+// registerVendorSubmodule adds already cloned dependency as submodule and
+// moves its git directory into .git/modules. It modifies .gitmodules and
+// index, so calls must be serialized.
+func registerVendorSubmodule(importpath string, url string) error {
+	target := getVendorPath(importpath)
+
+	recordCreatedDir(getVendorModulesDir(), importpath)
+
+	// git directory of previously removed submodule is reused by git
+	// submodule add -f, so it must survive cleanup
+	_, err := os.Lstat(filepath.Join(getVendorModulesDir(), importpath))
+	newModule := os.IsNotExist(err)
+
+	_, err = executeChange(
+		exec.Command("git", "submodule", "add", "-f", url, target),
+	)
+	if err != nil {
+		cleanupVendorSubmodule(importpath, newModule)
+
+		return karma.Format(
+			err, "unable to add submodule %s", target,
+		)
+	}
+
+	_, err = executeChange(
+		exec.Command("git", "submodule", "absorbgitdirs", target),
+	)
+	if err != nil {
+		cleanupVendorSubmodule(importpath, newModule)
+
+		return karma.Format(
+			err, "unable to move git directory of %s into .git/modules", target,
+		)
+	}
+
+	return nil
+}
+
+func removeVendorSubmodule(importpath string) error {
+	vendor := getVendorPath(importpath)
+
+	_, err := executeChange(
+		exec.Command("git", "submodule", "deinit", "-f", vendor),
+	)
+	if err != nil {
+		return karma.Format(
+			err, "unable to deinit vendor submodule: %s", vendor,
+		)
+	}
+
+	_, err = executeChange(
+		exec.Command("git", "rm", "--force", vendor),
+	)
+	if err != nil {
+		return karma.Format(
+			err, "unable to remove vendor directory: %s", vendor,
+		)
+	}
+
+	modules := filepath.Join(".git", "modules", getToplevelPath(vendor))
+
+	// git directory is kept until the end of transaction, so submodule can
+	// be restored if command fails.
+	activeTransaction.Lock()
+	tx := activeTransaction.transaction
+	activeTransaction.Unlock()
+
+	if tx != nil {
+		err = tx.trashModule(filepath.Join(toplevel, modules))
+	} else {
+		_, err = executeChange(
+			exec.Command("rm", "-r", getProjectPath(modules)),
+		)
+	}
+	if err != nil {
+		return karma.Format(
+			err, "unable to remove .git/modules/%s directory", vendor,
+		)
+	}
+
+	return nil
+}
+
+func updateVendorSubmodule(importpath string, version string) error {
+	err := ensureVendorSubmoduleInitialized(importpath)
+	if err != nil {
+		return err
+	}
+
+	if version == "" {
+		branch, err := getVendorSubmoduleBranch(importpath, false)
+		if err != nil {
+			return err
+		}
+
+		return pullVendorSubmodule(importpath, branch)
+	}
+
+	cwd := filepath.Join(workdir, getVendorPath(importpath))
+
+	_, err = execute(exec.Command("git", "-C", cwd, "show", version))
+	if err != nil {
+		_, err := executeChange(
+			exec.Command("git", "-C", cwd, "fetch", "--tags", "origin"),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = executeChange(
+		exec.Command("git", "-C", cwd, "checkout", version),
+	)
 	return err
 }
 
+// setVendorSubmoduleURL changes remote URL of vendor submodule in
+// .gitmodules and synchronizes it into git config of submodule. The URL is
+// changed only if commit recorded for submodule is reachable at new URL.
+func setVendorSubmoduleURL(importpath string, url string) error {
+	var (
+		vendor = getVendorPath(importpath)
+		cwd    = filepath.Join(workdir, vendor)
+	)
+
+	gitmodules, err := getVendorGitmodules()
+	if err != nil {
+		return err
+	}
+
+	section, ok := gitmodules[importpath]
+	if !ok {
+		return fmt.Errorf(
+			"vendor submodule %s is not found in .gitmodules", importpath,
+		)
+	}
+
+	output, err := execute(exec.Command("git", "rev-parse", ":./"+vendor))
+	if err != nil {
+		return karma.Format(
+			err, "unable to get recorded commit of %s", vendor,
+		)
+	}
+
+	commit := strings.TrimSpace(output)
+
+	// fetch into directory of uninitialized submodule would fetch into main
+	// repository, so recorded commit can't be checked there.
+	if isVendorSubmoduleInitialized(importpath) {
+		found, err := isCommitReachable(cwd, url, commit)
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			return fmt.Errorf(
+				"commit %s of %s is not found at %s", commit, importpath, url,
+			)
+		}
+	} else {
+		logger.Warningf(
+			"submodule %s is not initialized, "+
+				"skipping check that commit %s is found at %s",
+			importpath, commit, url,
+		)
+	}
+
+	indexMutex.Lock()
+	defer indexMutex.Unlock()
+
+	_, err = executeChange(
+		exec.Command(
+			"git", "config", "-f", getGitmodulesPath(),
+			"submodule."+section.Name+".url", url,
+		),
+	)
+	if err != nil {
+		return karma.Format(
+			err, "unable to change URL of %s in .gitmodules", importpath,
+		)
+	}
+
+	_, err = executeChange(exec.Command("git", "add", getGitmodulesPath()))
+	if err != nil {
+		return karma.Format(
+			err, "unable to add .gitmodules to index",
+		)
+	}
+
+	_, err = executeChange(
+		exec.Command("git", "submodule", "sync", "--", vendor),
+	)
+	if err != nil {
+		return karma.Format(
+			err, "unable to sync URL of submodule %s", vendor,
+		)
+	}
+
+	return nil
+}
+
+// isCommitReachable fetches branches and tags of given remote into temporary
+// refs of repository and checks that any of them contains given commit.
+func isCommitReachable(cwd string, url string, commit string) (bool, error) {
+	const namespace = "refs/manul/reachable/"
+
+	defer func() {
+		output, err := execute(
+			exec.Command(
+				"git", "-C", cwd, "for-each-ref",
+				"--format=delete %(refname)", namespace,
+			),
+		)
+		if err != nil {
+			logger.Warning(err)
+			return
+		}
+
+		cmd := exec.Command("git", "-C", cwd, "update-ref", "--stdin")
+		cmd.Stdin = strings.NewReader(output)
+
+		_, err = execute(cmd)
+		if err != nil {
+			logger.Warning(err)
+		}
+	}()
+
+	_, err := execute(
+		exec.Command(
+			"git", "-C", cwd, "fetch", "--no-tags", url,
+			"+refs/heads/*:"+namespace+"heads/*",
+			"+refs/tags/*:"+namespace+"tags/*",
+		),
+	)
+	if err != nil {
+		return false, karma.Format(
+			err, "unable to fetch %s", url,
+		)
+	}
+
+	output, err := execute(
+		exec.Command(
+			"git", "-C", cwd, "for-each-ref",
+			"--contains", commit, "--format=%(refname)", namespace,
+		),
+	)
+	if err != nil {
+		return false, karma.Format(
+			err, "unable to find refs containing %s", commit,
+		)
+	}
+
+	return strings.TrimSpace(output) != "", nil
+}
+
+// pullVendorSubmodule checks out given remote branch in vendor submodule and
+// pulls latest changes of it.
+func pullVendorSubmodule(importpath string, branch string) error {
+	err := ensureVendorSubmoduleInitialized(importpath)
+	if err != nil {
+		return err
+	}
+
+	cwd := filepath.Join(workdir, getVendorPath(importpath))
+
+	_, err = executeChange(
+		exec.Command("git", "-C", cwd, "fetch", "origin", branch),
+	)
+	if err != nil {
+		return karma.Format(
+			err, "unable to fetch branch %s", branch,
+		)
+	}
+
+	_, err = executeChange(
+		exec.Command(
+			"git", "-C", cwd, "checkout", "-B", branch, "origin/"+branch,
+		),
+	)
+	if err != nil {
+		return karma.Format(
+			err, "unable to checkout branch %s", branch,
+		)
+	}
+
+	return nil
+}
+
+// getVendorSubmoduleBranch returns branch tracked by vendor submodule. The
+// branch is taken from .gitmodules, if it's not recorded there or detect is
+// true, default branch of remote repository is used and recorded into
+// .gitmodules, so next updates use the same branch.
+func getVendorSubmoduleBranch(importpath string, detect bool) (string, error) {
+	gitmodules, err := getVendorGitmodules()
+	if err != nil {
+		return "", err
+	}
+
+	section, ok := gitmodules[importpath]
+	if !ok {
+		return "", fmt.Errorf(
+			"vendor submodule %s is not found in .gitmodules", importpath,
+		)
+	}
+
+	if section.Branch != "" && !detect {
+		return section.Branch, nil
+	}
+
+	err = ensureVendorSubmoduleInitialized(importpath)
+	if err != nil {
+		return "", err
+	}
+
+	branch, err := getVendorSubmoduleDefaultBranch(importpath)
+	if err != nil {
+		return "", err
+	}
+
+	if branch == section.Branch {
+		return branch, nil
+	}
+
+	logger.Debugf("recording branch %s for %s", branch, importpath)
+
+	indexMutex.Lock()
+	defer indexMutex.Unlock()
+
+	_, err = executeChange(
+		exec.Command(
+			"git", "config", "-f", getGitmodulesPath(),
+			"submodule."+section.Name+".branch", branch,
+		),
+	)
+	if err != nil {
+		return "", karma.Format(
+			err, "unable to record branch of %s in .gitmodules", importpath,
+		)
+	}
+
+	_, err = executeChange(exec.Command("git", "add", getGitmodulesPath()))
+	if err != nil {
+		return "", karma.Format(
+			err, "unable to add .gitmodules to index",
+		)
+	}
+
+	return branch, nil
+}
+
+// getVendorSubmoduleRemoteTags returns names of tags which exist in remote
+// repository of vendor submodule.
+func getVendorSubmoduleRemoteTags(importpath string) ([]string, error) {
+	err := ensureVendorSubmoduleInitialized(importpath)
+	if err != nil {
+		return nil, err
+	}
+
+	cwd := filepath.Join(workdir, getVendorPath(importpath))
+
+	output, err := executeStdout(
+		exec.Command("git", "-C", cwd, "ls-remote", "--tags", "--refs", "origin"),
+	)
+	if err != nil {
+		return nil, karma.Format(
+			err, "unable to list remote tags of %s", importpath,
+		)
+	}
+
+	var tags []string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+
+		tags = append(tags, strings.TrimPrefix(fields[1], "refs/tags/"))
+	}
+
+	return tags, nil
+}
+
+// getVendorSubmoduleDefaultBranch returns branch which HEAD of remote
+// repository of vendor submodule points to.
+func getVendorSubmoduleDefaultBranch(importpath string) (string, error) {
+	err := ensureVendorSubmoduleInitialized(importpath)
+	if err != nil {
+		return "", err
+	}
+
+	cwd := filepath.Join(workdir, getVendorPath(importpath))
+
+	output, err := executeStdout(
+		exec.Command("git", "-C", cwd, "ls-remote", "--symref", "origin", "HEAD"),
+	)
+	if err != nil {
+		return "", karma.Format(
+			err, "unable to get remote HEAD of %s", importpath,
+		)
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[0] == "ref:" && fields[2] == "HEAD" {
+			return strings.TrimPrefix(fields[1], "refs/heads/"), nil
+		}
+	}
+
+	return "", fmt.Errorf("remote HEAD of %s is not a branch", importpath)
+}
+
+// resolveVendorSubmoduleTag returns the latest remote tag of vendor
+// submodule which satisfies given semver constraint.
+func resolveVendorSubmoduleTag(
+	importpath string,
+	constraint string,
+) (string, error) {
+	matches, err := parseSemverConstraint(constraint)
+	if err != nil {
+		return "", err
+	}
+
+	if modulePath != "" {
+		isAllowed := getModuleVersionFilter(importpath)
+		matches = both(matches, isAllowed)
+	}
+
+	tags, err := getVendorSubmoduleRemoteTags(importpath)
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		latest    semver
+		latestTag string
+	)
+
+	for _, tag := range tags {
+		version, ok := parseSemver(tag)
+		if !ok || !matches(version) {
+			continue
+		}
+
+		if latestTag == "" || latest.Less(version) {
+			latest = version
+			latestTag = tag
+		}
+	}
+
+	if latestTag == "" {
+		if constraint == "" {
+			return "", fmt.Errorf("%s has no semver tags", importpath)
+		}
+
+		return "", fmt.Errorf(
+			"%s has no tags matching %s", importpath, constraint,
+		)
+	}
+
+	return latestTag, nil
+}
+
 func getRootImportpath(pkg *build.Package, importpath string) (string, error) {
 	cmd := exec.Command(
 		"git",
@@ -0,0 +1,14 @@
+:project "main.go" <<GO
+package main
+
+func main() {
+}
+GO
+
+tests:not tests:ensure :manul --ca-file missing.pem -Q
+tests:assert-stderr "unable to read CA file"
+
+tests:ensure touch empty.pem
+
+tests:not tests:ensure :manul --ca-file empty.pem -Q
+tests:assert-stderr "no certificates found in CA file"
@@ -0,0 +1,26 @@
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+
+func main() {
+    foo.Foo()
+}
+GO
+
+:lib "github.com/kovetskiy/manul-test-foo"
+
+tests:ensure git config user.name manul
+tests:ensure git config user.email manul@localhost
+
+tests:ensure :manul --commit -I github.com/kovetskiy/manul-test-foo=3c2b599
+
+tests:ensure git log -1 --format=%s
+tests:assert-stdout "vendor: add github.com/kovetskiy/manul-test-foo"
+
+tests:ensure git log -1 --format=%b
+tests:assert-stdout "github.com/kovetskiy/manul-test-foo 3c2b599"
+
+tests:ensure git status --short -- .gitmodules vendor
+tests:assert-no-diff stdout <<STATUS
+STATUS
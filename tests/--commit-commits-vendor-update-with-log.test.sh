@@ -0,0 +1,34 @@
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+
+func main() {
+    foo.Foo()
+}
+GO
+
+:lib "github.com/kovetskiy/manul-test-foo"
+
+tests:ensure git config user.name manul
+tests:ensure git config user.email manul@localhost
+
+tests:ensure :manul --commit -I github.com/kovetskiy/manul-test-foo=3c2b599
+
+tests:ensure :manul --commit -U github.com/kovetskiy/manul-test-foo=master
+
+tests:ensure git log -1 --format=%s
+tests:assert-stdout "vendor: update github.com/kovetskiy/manul-test-foo"
+
+tests:ensure git log -1 --format=%b
+tests:assert-stdout-re "^    github.com/kovetskiy/manul-test-foo 3c2b599 -> [0-9a-f]{7}$"
+tests:assert-stdout-re "^        [0-9a-f]{7} .+"
+
+tests:ensure git status --short -- .gitmodules vendor
+tests:assert-no-diff stdout <<STATUS
+STATUS
+
+tests:ensure echo >> .gitmodules
+
+tests:not tests:ensure :manul --commit -U github.com/kovetskiy/manul-test-foo=3c2b599
+tests:assert-stderr "have uncommitted changes"
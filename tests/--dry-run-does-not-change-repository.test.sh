@@ -0,0 +1,38 @@
+:lib github.com/kovetskiy/manul-test-foo
+
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+
+func main() {
+    foo.Foo()
+}
+GO
+
+tests:ensure :manul --dry-run -I
+
+tests:assert-no-diff stdout <<COMMANDS
+git clone https://github.com/kovetskiy/manul-test-foo vendor/github.com/kovetskiy/manul-test-foo
+git submodule add -f https://github.com/kovetskiy/manul-test-foo vendor/github.com/kovetskiy/manul-test-foo
+git submodule absorbgitdirs vendor/github.com/kovetskiy/manul-test-foo
+COMMANDS
+
+tests:ensure :manul -Q
+tests:assert-no-diff stdout <<VENDORS
+github.com/kovetskiy/manul-test-foo
+VENDORS
+
+tests:ensure :manul -I
+tests:ensure :manul --dry-run -R
+
+tests:assert-no-diff stdout <<COMMANDS
+git submodule deinit -f vendor/github.com/kovetskiy/manul-test-foo
+git rm --force vendor/github.com/kovetskiy/manul-test-foo
+rm -r .git/modules/vendor/github.com/kovetskiy/manul-test-foo
+COMMANDS
+
+tests:ensure :manul -Q
+tests:assert-no-diff stdout <<VENDORS
+github.com/kovetskiy/manul-test-foo  9e1daede0e52ef8b214555d14431372672ab6be5
+VENDORS
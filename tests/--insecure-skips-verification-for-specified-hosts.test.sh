@@ -0,0 +1,52 @@
+_process=""
+
+:project "main.go" <<GO
+package main
+
+import foo "__blankd__/kovetskiy/manul-test-foo"
+
+func main() {
+    foo.Foo()
+}
+GO
+
+tests:put server <<SRV
+#!/bin/bash
+
+cat <<HTTP
+200 OK
+
+<meta name="go-import" content="localhost:60001/kovetskiy/manul-test-foo git https://github.com/kovetskiy/manul-test-foo" />
+HTTP
+SRV
+tests:ensure chmod +x $(tests:get-tmp-dir)/server
+
+
+:lib "github.com/kovetskiy/manul-test-foo"
+tests:ensure  mv \
+    $(tests:get-tmp-dir)/go/src/github.com \
+    $(tests:get-tmp-dir)/go/src/__blankd__
+
+tests:ensure blankd \
+    -l localhost:60001 \
+    -e $(tests:get-tmp-dir)/server \
+    -o /tmp/blankd.log \
+    --tls
+tests:value _process cat $(tests:get-stdout-file)
+:stop_blankd() {
+    if [[ "$_process" ]]; then
+        tests:eval kill "$_process"
+    fi
+}
+trap :stop_blankd EXIT
+
+export XDG_CACHE_HOME=$(tests:get-tmp-dir)/cache
+
+tests:not tests:ensure :manul --integration-test --insecure example.com -I
+tests:not tests:ensure test -e vendor/localhost:60001/kovetskiy/manul-test-foo
+
+tests:ensure :manul --integration-test --insecure example.com,localhost -I
+
+tests:ensure git config -f .gitmodules \
+    submodule.vendor/localhost:60001/kovetskiy/manul-test-foo.url
+tests:assert-stdout "https://github.com/kovetskiy/manul-test-foo"
@@ -0,0 +1,19 @@
+:project "main.go" <<GO
+package main
+
+import foo "__blankd__/kovetskiy/manul-test-foo"
+
+func main() {
+    foo.Foo()
+}
+GO
+
+:lib "github.com/kovetskiy/manul-test-foo"
+tests:ensure  mv \
+    $(tests:get-tmp-dir)/go/src/github.com \
+    $(tests:get-tmp-dir)/go/src/__blankd__
+
+export XDG_CACHE_HOME=$(tests:get-tmp-dir)/cache
+
+tests:not tests:ensure :manul --integration-test --offline -I
+tests:assert-stderr "unable to resolve repository root of localhost:60001/kovetskiy/manul-test-foo in offline mode"
@@ -0,0 +1,47 @@
+:lib github.com/kovetskiy/manul-test-foo
+
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+
+func main() {
+    foo.Foo()
+}
+GO
+
+tests:ensure git clone --bare \
+    https://github.com/kovetskiy/manul-test-foo \
+    $(tests:get-tmp-dir)/mirror/manul-test-foo
+
+tests:value hash git -C $(tests:get-tmp-dir)/mirror/manul-test-foo \
+    rev-list --max-parents=0 HEAD
+
+proxy=$(tests:get-tmp-dir)/proxy/github.com/kovetskiy/manul-test-foo/@v
+
+tests:ensure mkdir -p $proxy
+
+echo v0.0.1 > $proxy/list
+
+cat > $proxy/v0.0.1.info <<JSON
+{
+    "Version": "v0.0.1",
+    "Time": "2017-01-01T00:00:00Z",
+    "Origin": {
+        "VCS": "git",
+        "URL": "file://$(tests:get-tmp-dir)/mirror/manul-test-foo",
+        "Hash": "$hash"
+    }
+}
+JSON
+
+export GOPROXY=file://$(tests:get-tmp-dir)/proxy
+
+tests:ensure :manul --proxy -I
+
+tests:ensure git -C vendor/github.com/kovetskiy/manul-test-foo rev-parse HEAD
+tests:assert-stdout "$hash"
+
+tests:ensure git config -f .gitmodules \
+    submodule.vendor/github.com/kovetskiy/manul-test-foo.url
+tests:assert-stdout "file://$(tests:get-tmp-dir)/mirror/manul-test-foo"
@@ -0,0 +1,56 @@
+:lib github.com/kovetskiy/manul-test-foo
+
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+
+func main() {
+    foo.Foo()
+}
+GO
+
+tests:ensure git clone --bare \
+    https://github.com/kovetskiy/manul-test-foo \
+    $(tests:get-tmp-dir)/mirror/manul-test-foo
+
+tests:value hash git -C $(tests:get-tmp-dir)/mirror/manul-test-foo \
+    rev-list --max-parents=0 HEAD
+
+proxy=$(tests:get-tmp-dir)/proxy/github.com/kovetskiy/manul-test-foo/@v
+
+tests:ensure mkdir -p $proxy
+
+printf "v0.0.1\nv0.0.2-rc.1\n" > $proxy/list
+
+:info() {
+    local version="$1"
+
+    cat > $proxy/$version.info <<JSON
+{
+    "Version": "$version",
+    "Time": "2017-01-01T00:00:00Z",
+    "Origin": {
+        "VCS": "git",
+        "URL": "file://$(tests:get-tmp-dir)/mirror/manul-test-foo",
+        "Hash": "$hash"
+    }
+}
+JSON
+}
+
+:info v0.0.1
+
+export GOPROXY=file://$(tests:get-tmp-dir)/proxy
+
+tests:ensure :manul --proxy -I
+tests:assert-stderr "recorded by GOPROXY for github.com/kovetskiy/manul-test-foo v0.0.1"
+
+tests:ensure :manul -R
+
+printf "v2.0.0+incompatible\nv2.1.0-rc.1\n" > $proxy/list
+
+:info v2.0.0+incompatible
+
+tests:ensure :manul --proxy -I
+tests:assert-stderr "recorded by GOPROXY for github.com/kovetskiy/manul-test-foo v2.0.0+incompatible"
@@ -0,0 +1,30 @@
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+
+func main() {
+    foo.Foo()
+}
+GO
+
+:lib "github.com/kovetskiy/manul-test-foo"
+
+tests:ensure git config user.name manul
+tests:ensure git config user.email manul@localhost
+
+tests:ensure :manul -I github.com/kovetskiy/manul-test-foo=3c2b599
+tests:ensure git commit -m vendor
+
+tests:ensure :manul -U github.com/kovetskiy/manul-test-foo=master
+tests:ensure git commit -a -m update
+
+tests:ensure :manul -D HEAD~1 HEAD
+tests:assert-stdout-re "github.com/kovetskiy/manul-test-foo 3c2b599\.\.[0-9a-f]{7} \([0-9]+ commits?"
+
+tests:ensure :manul -D HEAD~1 HEAD --format json
+tests:assert-stdout '"status": "updated"'
+
+tests:ensure :manul -D HEAD HEAD~1
+tests:assert-stdout-re "github.com/kovetskiy/manul-test-foo [0-9a-f]{7}\.\.3c2b599 \(downgraded"
+
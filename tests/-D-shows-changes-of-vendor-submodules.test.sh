@@ -0,0 +1,23 @@
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+
+func main() {
+    foo.Foo()
+}
+GO
+
+:lib "github.com/kovetskiy/manul-test-foo"
+
+tests:ensure git config user.name manul
+tests:ensure git config user.email manul@localhost
+
+tests:ensure :manul -I github.com/kovetskiy/manul-test-foo=3c2b599
+tests:ensure git commit -m vendor
+
+tests:ensure :manul -U --log github.com/kovetskiy/manul-test-foo=master
+tests:assert-stdout-re "github.com/kovetskiy/manul-test-foo 3c2b599\.\.[0-9a-f]{7} \([0-9]+ commits?, [0-9]+ files? changed\)"
+
+tests:ensure :manul -D
+tests:assert-stdout-re "github.com/kovetskiy/manul-test-foo 3c2b599\.\.[0-9a-f]{7}"
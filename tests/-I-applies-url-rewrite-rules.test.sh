@@ -0,0 +1,24 @@
+:lib github.com/kovetskiy/manul-test-foo
+
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+
+func main() {
+    foo.Foo()
+}
+GO
+
+tests:ensure git clone --bare \
+    https://github.com/kovetskiy/manul-test-foo \
+    $(tests:get-tmp-dir)/mirror/manul-test-foo
+
+tests:ensure git config -f .manul manul.rewrite \
+    "github.com/kovetskiy/ file://$(tests:get-tmp-dir)/mirror/"
+
+tests:ensure :manul -I
+
+tests:ensure git config -f .gitmodules \
+    submodule.vendor/github.com/kovetskiy/manul-test-foo.url
+tests:assert-stdout "file://$(tests:get-tmp-dir)/mirror/manul-test-foo"
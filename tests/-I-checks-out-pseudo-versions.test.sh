@@ -0,0 +1,33 @@
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+import "github.com/kovetskiy/manul-test-bar"
+
+func main() {
+    foo.Foo()
+    bar.Bar()
+}
+GO
+
+:lib "github.com/kovetskiy/manul-test-foo"
+:lib "github.com/kovetskiy/manul-test-bar"
+
+tests:value foo git -C $(tests:get-tmp-dir)/go/src/github.com/kovetskiy/manul-test-foo \
+    rev-parse --short=12 3c2b599
+tests:value bar git -C $(tests:get-tmp-dir)/go/src/github.com/kovetskiy/manul-test-bar \
+    rev-parse --short=12 db5bf508
+
+tests:ensure git config -f .manul --add manul.pin \
+    "github.com/kovetskiy/manul-test-foo=v1.0.1-pre.0.20160101000000-$foo"
+tests:ensure git config -f .manul --add manul.pin \
+    "github.com/kovetskiy/manul-test-bar=v2.0.1-0.20160101000000-$bar+incompatible"
+
+tests:ensure :manul -I
+tests:assert-stderr "added 2 submodules"
+
+tests:ensure git -C vendor/github.com/kovetskiy/manul-test-foo rev-parse --short=12 HEAD
+tests:assert-stdout "$foo"
+
+tests:ensure git -C vendor/github.com/kovetskiy/manul-test-bar rev-parse --short=12 HEAD
+tests:assert-stdout "$bar"
@@ -0,0 +1,46 @@
+_process=""
+
+:lib github.com/kovetskiy/manul-test-foo
+
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+
+func main() {
+    foo.Foo()
+}
+GO
+
+tests:put server <<SRV
+#!/bin/bash
+
+cat <<HTTP
+401 Unauthorized
+
+HTTP
+SRV
+tests:ensure chmod +x $(tests:get-tmp-dir)/server
+
+tests:ensure blankd \
+    -l localhost:60001 \
+    -e $(tests:get-tmp-dir)/server \
+    -o /tmp/blankd.log \
+    --tls
+tests:value _process cat $(tests:get-stdout-file)
+:stop_blankd() {
+    if [[ "$_process" ]]; then
+        tests:eval kill "$_process"
+    fi
+}
+trap :stop_blankd EXIT
+
+unset GIT_ASKPASS SSH_ASKPASS
+
+tests:ensure git config -f .manul manul.rewrite \
+    "github.com/kovetskiy/ https://localhost:60001/"
+
+tests:not tests:ensure :manul --insecure-skip-verify -I
+tests:assert-stderr "localhost:60001/manul-test-foo: authentication failed"
+
+tests:not tests:ensure test -e vendor/github.com/kovetskiy/manul-test-foo
@@ -0,0 +1,20 @@
+:lib github.com/kovetskiy/manul-test-foo
+
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+
+func main() {
+    foo.Foo()
+}
+GO
+
+tests:ensure mkdir -p vendor/github.com/kovetskiy/manul-test-foo
+tests:ensure touch vendor/github.com/kovetskiy/manul-test-foo/foo.go
+
+tests:not tests:ensure :manul -I
+tests:assert-stderr "already exists and is not empty"
+
+tests:ensure test -e vendor/github.com/kovetskiy/manul-test-foo/foo.go
+tests:not tests:ensure test -e .gitmodules
@@ -0,0 +1,20 @@
+:lib github.com/kovetskiy/manul-test-foo
+
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+
+func main() {
+    foo.Foo()
+}
+GO
+
+tests:ensure git config -f .manul manul.rewrite \
+    "github.com/kovetskiy/ file://$(tests:get-tmp-dir)/missing/"
+
+tests:not tests:ensure :manul -I
+tests:assert-stderr "missing/manul-test-foo: repository not found"
+
+tests:not tests:ensure test -e vendor/github.com/kovetskiy/manul-test-foo
+tests:not tests:ensure test -e .gitmodules
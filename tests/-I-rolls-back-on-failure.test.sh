@@ -0,0 +1,30 @@
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+import "github.com/kovetskiy/manul-test-bar"
+
+func main() {
+    foo.Foo()
+    bar.Bar()
+}
+GO
+
+:lib "github.com/kovetskiy/manul-test-foo"
+:lib "github.com/kovetskiy/manul-test-bar"
+
+tests:not tests:ensure :manul -I \
+    github.com/kovetskiy/manul-test-foo \
+    github.com/kovetskiy/manul-test-bar=0000000
+tests:assert-stderr "changes are rolled back"
+
+tests:not tests:ensure test -e .gitmodules
+tests:not tests:ensure test -e vendor/github.com/kovetskiy/manul-test-foo
+tests:not tests:ensure test -e .git/modules/vendor
+
+tests:ensure git status --short
+tests:assert-no-diff stdout <<STATUS
+?? main.go
+STATUS
+
+tests:not tests:ensure git config --get-regexp '^submodule\.'
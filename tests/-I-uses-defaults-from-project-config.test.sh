@@ -0,0 +1,27 @@
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+import "github.com/kovetskiy/manul-test-bar"
+
+func main() {
+    foo.Foo()
+    bar.Bar()
+}
+GO
+
+:lib "github.com/kovetskiy/manul-test-foo"
+:lib "github.com/kovetskiy/manul-test-bar"
+
+tests:ensure git config -f .manul manul.pin \
+    "github.com/kovetskiy/manul-test-foo=3c2b599"
+tests:ensure git config -f .manul manul.ignore \
+    "github.com/kovetskiy/manul-test-bar"
+
+tests:ensure :manul -I
+tests:assert-stderr "added 1 submodule"
+
+tests:ensure git -C vendor/github.com/kovetskiy/manul-test-foo rev-parse --short=7 HEAD
+tests:assert-stdout "3c2b599"
+
+tests:not tests:ensure test -d vendor/github.com/kovetskiy/manul-test-bar
@@ -0,0 +1,28 @@
+:project "go.mod" <<MOD
+module project
+MOD
+
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+import "github.com/kovetskiy/manul-test-bar"
+
+func main() {
+    foo.Foo()
+    bar.Bar()
+}
+GO
+
+tests:ensure go mod tidy
+
+tests:ensure :manul -I
+
+tests:assert-stderr "added 2 submodules"
+tests:assert-stderr "adding submodule for github.com/kovetskiy/manul-test-bar"
+tests:assert-stderr "adding submodule for github.com/kovetskiy/manul-test-foo"
+
+tests:ensure grep '^# github.com/kovetskiy/manul-test-bar ' vendor/modules.txt
+tests:ensure grep '^# github.com/kovetskiy/manul-test-foo ' vendor/modules.txt
+
+tests:ensure go build -mod=vendor
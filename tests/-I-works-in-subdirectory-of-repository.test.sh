@@ -0,0 +1,22 @@
+:project "service/main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+
+func main() {
+    foo.Foo()
+}
+GO
+
+:lib "github.com/kovetskiy/manul-test-foo"
+
+tests:cd-tmp-dir go/src/project/service
+
+GOPATH=$(tests:get-tmp-dir)/go tests:ensure manul.test -I
+tests:assert-stderr "added 1 submodule"
+
+tests:ensure git -C .. config -f .gitmodules --get-regexp path
+tests:assert-stdout "service/vendor/github.com/kovetskiy/manul-test-foo"
+
+GOPATH=$(tests:get-tmp-dir)/go tests:ensure manul.test -Q -o
+tests:assert-stdout "github.com/kovetskiy/manul-test-foo"
@@ -0,0 +1,28 @@
+:lib github.com/kovetskiy/manul-test-foo
+
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+
+func main() {
+    foo.Foo()
+}
+GO
+
+tests:ensure :manul -I
+
+tests:ensure git submodule deinit -f vendor/github.com/kovetskiy/manul-test-foo
+
+tests:ensure :manul -M \
+    github.com/kovetskiy/manul-test-foo=file://$(tests:get-tmp-dir)/mirror/manul-test-foo
+tests:assert-stderr "submodule github.com/kovetskiy/manul-test-foo is not initialized"
+tests:assert-stderr "changed URL of 1 submodule"
+
+tests:ensure git config -f .gitmodules \
+    submodule.vendor/github.com/kovetskiy/manul-test-foo.url
+tests:assert-stdout "file://$(tests:get-tmp-dir)/mirror/manul-test-foo"
+
+tests:ensure git for-each-ref refs/manul/
+tests:assert-no-diff stdout <<REFS
+REFS
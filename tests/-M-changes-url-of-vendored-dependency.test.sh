@@ -0,0 +1,40 @@
+:lib github.com/kovetskiy/manul-test-foo
+:lib github.com/kovetskiy/manul-test-bar
+
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+import "github.com/kovetskiy/manul-test-bar"
+
+func main() {
+    foo.Foo()
+    bar.Bar()
+}
+GO
+
+tests:ensure :manul -I
+
+tests:ensure git clone --bare \
+    https://github.com/kovetskiy/manul-test-foo \
+    $(tests:get-tmp-dir)/mirror/manul-test-foo
+
+tests:ensure :manul -M \
+    github.com/kovetskiy/manul-test-foo=file://$(tests:get-tmp-dir)/mirror/manul-test-foo
+tests:assert-stderr "changed URL of 1 submodule"
+
+tests:ensure git config -f .gitmodules \
+    submodule.vendor/github.com/kovetskiy/manul-test-foo.url
+tests:assert-stdout "file://$(tests:get-tmp-dir)/mirror/manul-test-foo"
+
+tests:ensure git -C vendor/github.com/kovetskiy/manul-test-foo \
+    config remote.origin.url
+tests:assert-stdout "file://$(tests:get-tmp-dir)/mirror/manul-test-foo"
+
+tests:not tests:ensure :manul -M \
+    github.com/kovetskiy/manul-test-bar=file://$(tests:get-tmp-dir)/mirror/manul-test-foo
+tests:assert-stderr "is not found at"
+
+tests:ensure git config -f .gitmodules \
+    submodule.vendor/github.com/kovetskiy/manul-test-bar.url
+tests:assert-stdout "https://github.com/kovetskiy/manul-test-bar"
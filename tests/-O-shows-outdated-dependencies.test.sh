@@ -0,0 +1,31 @@
+:lib github.com/kovetskiy/manul-test-bar
+
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-bar"
+
+func main() {
+    bar.Bar()
+}
+GO
+
+tests:ensure :manul -I github.com/kovetskiy/manul-test-bar=db5bf508
+
+tests:ensure :manul -O --format tsv \| cut -f1-4
+tests:assert-no-diff stdout <<REPORT
+github.com/kovetskiy/manul-test-bar	master	db5bf508ab9ffad0e490c83555fec43d272e2b13	9a5d4e050e8660fe7b616ce503e7c80a04e1e2db
+REPORT
+
+tests:not tests:ensure :manul -O --max-age 1
+tests:assert-stderr "1 vendored dependencies are behind upstream"
+
+tests:not tests:ensure :manul -O --max-age 0
+tests:assert-stderr "1 vendored dependencies are behind upstream"
+
+tests:not tests:ensure :manul -O --max-age week
+tests:assert-stderr "invalid max age: week"
+
+tests:ensure :manul -U
+tests:ensure :manul -O --max-age 1
+tests:ensure :manul -O --max-age 0
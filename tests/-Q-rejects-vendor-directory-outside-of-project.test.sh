@@ -0,0 +1,16 @@
+:project "main.go" <<GO
+package main
+
+func main() {
+}
+GO
+
+for vendor in "" "." ".." "../vendor" "/tmp/vendor" "vendor/../.."; do
+    tests:ensure git config -f .manul manul.vendor "'$vendor'"
+
+    tests:not tests:ensure :manul -Q
+    tests:assert-stderr "invalid manul.vendor"
+done
+
+tests:ensure git config -f .manul manul.vendor third_party/
+tests:ensure :manul -Q
@@ -0,0 +1,26 @@
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+import "github.com/kovetskiy/manul-test-bar"
+
+func main() {
+    foo.Foo()
+    bar.Bar()
+}
+GO
+
+:lib "github.com/kovetskiy/manul-test-foo"
+:lib "github.com/kovetskiy/manul-test-bar"
+
+tests:ensure :manul -Q --ignore 'github.com/*/manul-test-bar'
+tests:assert-no-diff stdout <<VENDORS
+github.com/kovetskiy/manul-test-foo
+
+ignored:
+github.com/kovetskiy/manul-test-bar
+VENDORS
+
+tests:ensure :manul -I --ignore 'github.com/*/manul-test-bar'
+tests:assert-stderr "added 1 submodule"
+tests:not tests:ensure test -d vendor/github.com/kovetskiy/manul-test-bar
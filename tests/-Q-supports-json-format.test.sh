@@ -0,0 +1,34 @@
+:lib github.com/kovetskiy/manul-test-foo
+:lib github.com/kovetskiy/manul-test-bar
+
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+import "github.com/kovetskiy/manul-test-bar"
+
+func main() {
+    foo.Foo()
+    bar.Bar()
+}
+GO
+
+tests:ensure :manul -I github.com/kovetskiy/manul-test-bar
+tests:ensure :manul -Q --format json
+
+tests:assert-no-diff stdout <<JSON
+[
+    {
+        "importpath": "github.com/kovetskiy/manul-test-bar",
+        "vendored": true,
+        "commit": "9a5d4e050e8660fe7b616ce503e7c80a04e1e2db",
+        "url": "https://github.com/kovetskiy/manul-test-bar",
+        "direct": true
+    },
+    {
+        "importpath": "github.com/kovetskiy/manul-test-foo",
+        "vendored": false,
+        "direct": true
+    }
+]
+JSON
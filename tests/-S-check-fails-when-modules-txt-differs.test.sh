@@ -0,0 +1,40 @@
+:project "go.mod" <<MOD
+module project
+MOD
+
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-bar"
+
+func main() {
+    bar.Bar()
+}
+GO
+
+tests:ensure go mod tidy
+
+tests:ensure :manul -I
+tests:ensure :manul -S --check
+
+tests:ensure git -C vendor/github.com/kovetskiy/manul-test-bar checkout db5bf508
+
+tests:not tests:ensure :manul -S --check
+tests:assert-stderr "doesn't match vendor submodules"
+
+tests:ensure :manul -S
+tests:assert-stderr "updating go.mod requirement github.com/kovetskiy/manul-test-bar"
+
+tests:ensure git diff --name-only -- go.mod vendor/modules.txt
+tests:assert-no-diff stdout <<DIFF
+DIFF
+
+tests:ensure :manul -S --check
+tests:ensure go build -mod=vendor
+
+tests:ensure grep -v -x github.com/kovetskiy/manul-test-bar \
+    vendor/modules.txt \> modules.txt
+tests:ensure mv modules.txt vendor/modules.txt
+
+tests:not tests:ensure :manul -S --check
+tests:assert-stderr "package github.com/kovetskiy/manul-test-bar is not listed"
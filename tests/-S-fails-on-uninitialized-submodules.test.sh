@@ -0,0 +1,32 @@
+:project "go.mod" <<MOD
+module project
+MOD
+
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-bar"
+
+func main() {
+    bar.Bar()
+}
+GO
+
+tests:ensure go mod tidy
+
+tests:ensure :manul -I
+tests:ensure :manul -S --check
+
+tests:ensure cp go.mod go.mod.orig
+tests:ensure cp vendor/modules.txt modules.txt.orig
+
+tests:ensure git submodule deinit -f vendor/github.com/kovetskiy/manul-test-bar
+
+tests:not tests:ensure :manul -S --check
+tests:assert-stderr "uninitialized vendor submodules: github.com/kovetskiy/manul-test-bar"
+
+tests:not tests:ensure :manul -S
+tests:assert-stderr "uninitialized vendor submodules: github.com/kovetskiy/manul-test-bar"
+
+tests:ensure cmp go.mod go.mod.orig
+tests:ensure cmp vendor/modules.txt modules.txt.orig
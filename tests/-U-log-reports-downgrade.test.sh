@@ -0,0 +1,28 @@
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+
+func main() {
+    foo.Foo()
+}
+GO
+
+:lib "github.com/kovetskiy/manul-test-foo"
+
+tests:ensure git config user.name manul
+tests:ensure git config user.email manul@localhost
+
+tests:ensure :manul -I github.com/kovetskiy/manul-test-foo=master
+tests:ensure git commit -m vendor
+
+tests:ensure :manul -U --log github.com/kovetskiy/manul-test-foo=3c2b599
+tests:assert-stdout-re "github.com/kovetskiy/manul-test-foo [0-9a-f]{7}\.\.3c2b599 \(downgraded: [0-9]+ commits? reverted"
+tests:assert-stdout-re "^    [0-9a-f]{7} .+"
+tests:not tests:assert-stdout "force-push"
+
+tests:ensure git commit -m downgrade
+
+tests:ensure :manul -U --log --format json github.com/kovetskiy/manul-test-foo=master
+tests:assert-stdout '"importpath": "github.com/kovetskiy/manul-test-foo"'
+tests:assert-stdout '"status": "updated"'
@@ -0,0 +1,22 @@
+:lib github.com/kovetskiy/manul-test-bar
+
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-bar"
+
+func main() {
+    bar.Bar()
+}
+GO
+
+tests:ensure :manul -I github.com/kovetskiy/manul-test-bar=db5bf508
+tests:ensure :manul -U
+
+tests:ensure git config -f .gitmodules \
+    submodule.vendor/github.com/kovetskiy/manul-test-bar.branch
+tests:assert-stdout "master"
+
+tests:ensure git -C vendor/github.com/kovetskiy/manul-test-bar \
+    rev-parse --abbrev-ref HEAD
+tests:assert-stdout "master"
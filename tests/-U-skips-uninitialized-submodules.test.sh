@@ -0,0 +1,38 @@
+:lib github.com/kovetskiy/manul-test-foo
+:lib github.com/kovetskiy/manul-test-bar
+
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+import "github.com/kovetskiy/manul-test-bar"
+
+func main() {
+    foo.Foo()
+    bar.Bar()
+}
+GO
+
+tests:ensure git config user.name manul
+tests:ensure git config user.email manul@localhost
+
+tests:ensure :manul -I
+tests:ensure git add main.go
+tests:ensure git commit -m vendor
+
+tests:ensure git submodule deinit -f vendor/github.com/kovetskiy/manul-test-bar
+
+tests:value head git rev-parse HEAD
+tests:value branch git symbolic-ref HEAD
+
+tests:ensure :manul -U --to default-branch
+tests:assert-stderr "skipping github.com/kovetskiy/manul-test-bar, submodule is not initialized"
+
+tests:ensure :manul -U
+tests:assert-stderr "skipping github.com/kovetskiy/manul-test-bar, submodule is not initialized"
+
+tests:ensure git rev-parse HEAD
+tests:assert-stdout "$head"
+
+tests:ensure git symbolic-ref HEAD
+tests:assert-stdout "$branch"
@@ -0,0 +1,28 @@
+:lib github.com/kovetskiy/manul-test-foo
+:lib github.com/kovetskiy/manul-test-bar
+
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+import "github.com/kovetskiy/manul-test-bar"
+
+func main() {
+    foo.Foo()
+    bar.Bar()
+}
+GO
+
+tests:ensure :manul -I github.com/kovetskiy/manul-test-bar=db5bf508
+
+tests:ensure :manul -U --to default-branch github.com/kovetskiy/manul-test-bar
+tests:assert-stderr "updating vendor submodule github.com/kovetskiy/manul-test-bar to branch master"
+
+tests:ensure :manul -Q -o
+tests:assert-no-diff stdout <<VENDORS
+github.com/kovetskiy/manul-test-bar +9a5d4e050e8660fe7b616ce503e7c80a04e1e2db
+VENDORS
+
+tests:ensure git config -f .gitmodules \
+    submodule.vendor/github.com/kovetskiy/manul-test-bar.branch
+tests:assert-stdout "master"
@@ -0,0 +1,47 @@
+:lib github.com/kovetskiy/manul-test-foo
+
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+
+func main() {
+    foo.Foo()
+}
+GO
+
+upstream=$(tests:get-tmp-dir)/upstream/manul-test-foo
+
+tests:ensure git init "$upstream"
+for tag in v1.0.0 v1.2.0 v1.3.1 v2.0.0; do
+    tests:ensure git -C "$upstream" \
+        -c user.name=manul -c user.email=manul@localhost \
+        commit --allow-empty -m "$tag"
+    tests:ensure git -C "$upstream" tag "$tag"
+done
+
+tests:ensure git config -f .manul manul.rewrite \
+    "github.com/kovetskiy/ file://$(tests:get-tmp-dir)/upstream/"
+
+tests:ensure :manul -I github.com/kovetskiy/manul-test-foo=v1.0.0
+
+# arguments are evaluated by tests:ensure and then by :manul, so constraints
+# with < and > are passed through variable
+dependency="github.com/kovetskiy/manul-test-foo@<=1.2"
+tests:ensure :manul -U '"\$dependency"'
+tests:assert-stderr "updating vendor submodule github.com/kovetskiy/manul-test-foo to v1.2.0"
+
+tests:ensure :manul -U github.com/kovetskiy/manul-test-foo@^1
+tests:assert-stderr "updating vendor submodule github.com/kovetskiy/manul-test-foo to v1.3.1"
+
+tests:ensure :manul -U --to latest-tag github.com/kovetskiy/manul-test-foo
+tests:assert-stderr "updating vendor submodule github.com/kovetskiy/manul-test-foo to v2.0.0"
+
+tests:ensure :manul -U github.com/kovetskiy/manul-test-foo=v1.0.0
+
+dependency="github.com/kovetskiy/manul-test-foo@>=1.2"
+tests:ensure :manul -U '"\$dependency"'
+tests:assert-stderr "updating vendor submodule github.com/kovetskiy/manul-test-foo to v2.0.0"
+
+tests:not tests:ensure :manul -U github.com/kovetskiy/manul-test-foo=v1.0.0@^1
+tests:assert-stderr "both commit-ish and version constraint are specified"
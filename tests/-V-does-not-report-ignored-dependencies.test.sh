@@ -0,0 +1,19 @@
+:lib github.com/kovetskiy/manul-test-foo
+:lib github.com/kovetskiy/manul-test-bar
+
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+import "github.com/kovetskiy/manul-test-bar"
+
+func main() {
+    foo.Foo()
+    bar.Bar()
+}
+GO
+
+tests:ensure :manul -I
+
+tests:ensure :manul -V --ignore 'github.com/*/manul-test-bar'
+tests:assert-stderr "vendor is consistent with imports"
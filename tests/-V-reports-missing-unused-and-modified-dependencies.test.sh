@@ -0,0 +1,39 @@
+:lib github.com/kovetskiy/manul-test-foo
+:lib github.com/kovetskiy/manul-test-bar
+
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-foo"
+import "github.com/kovetskiy/manul-test-bar"
+
+func main() {
+    foo.Foo()
+    bar.Bar()
+}
+GO
+
+tests:not tests:ensure :manul -V
+tests:assert-stderr "github.com/kovetskiy/manul-test-bar is not vendored"
+tests:assert-stderr "github.com/kovetskiy/manul-test-foo is not vendored"
+
+tests:ensure :manul -I
+tests:ensure :manul -V
+tests:assert-stderr "vendor is consistent with imports"
+
+tests:ensure git -C vendor/github.com/kovetskiy/manul-test-bar checkout db5bf508
+
+:project "main.go" <<GO
+package main
+
+import "github.com/kovetskiy/manul-test-bar"
+
+func main() {
+    bar.Bar()
+}
+GO
+
+tests:not tests:ensure :manul -V
+tests:assert-stderr "github.com/kovetskiy/manul-test-foo is vendored, but not used"
+tests:assert-stderr "github.com/kovetskiy/manul-test-bar is checked out at db5bf508ab9ffad0e490c83555fec43d272e2b13"
+tests:assert-stderr "vendor is not consistent: 2 problems found"
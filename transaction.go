@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/reconquest/karma-go"
+)
+
+// transaction is a snapshot of repository state which is changed by
+// mutating commands: .gitmodules, index, config, module files and checked
+// out commits of vendor submodules. If command fails or is interrupted, the
+// repository is restored from snapshot.
+type transaction struct {
+	// files contains contents of files, nil means that file didn't exist.
+	files map[string][]byte
+
+	// index is a path of index file of main repository.
+	index string
+
+	// config is a path of config of main repository, submodule sections are
+	// added to it when submodules are added or initialized.
+	config string
+
+	// submodules maps import paths of vendor submodules to commits checked
+	// out in them.
+	submodules map[string]string
+
+	// trash is a directory where git directories of removed submodules are
+	// moved, so they can be restored.
+	trash string
+	moved map[string]string
+
+	// created contains directories of vendor submodules and their git
+	// directories which are created during transaction, rollback removes
+	// only them.
+	created []createdDir
+
+	// done is true if transaction is already committed or rolled back, it's
+	// changed only under activeTransaction lock.
+	done bool
+}
+
+// activeTransaction is a transaction of currently running command, it's
+// rolled back on interrupt. The lock is held during the whole rollback, so
+// failed command and interrupt handler never restore repository at the
+// same time.
+var activeTransaction = struct {
+	sync.Mutex
+	*transaction
+}{}
+
+// withTransaction runs given mutating command in transaction, which is
+// rolled back if command fails. Nothing is snapshotted in dry-run mode.
+func withTransaction(command func() error) error {
+	if dryRun {
+		return command()
+	}
+
+	tx, err := beginTransaction()
+	if err != nil {
+		return err
+	}
+
+	activeTransaction.Lock()
+	activeTransaction.transaction = tx
+	activeTransaction.Unlock()
+
+	err = command()
+
+	activeTransaction.Lock()
+	defer activeTransaction.Unlock()
+
+	activeTransaction.transaction = nil
+
+	// git processes receive interrupt too, so command fails while
+	// interrupt handler rolls back the transaction
+	if tx.done {
+		return err
+	}
+
+	if err != nil {
+		logger.Warningf("rolling back changes, because command failed")
+
+		rollbackErr := tx.rollback()
+		if rollbackErr != nil {
+			logger.Error(karma.Format(rollbackErr, "unable to roll back changes"))
+		}
+
+		return err
+	}
+
+	return tx.commit()
+}
+
+// handleInterrupts rolls back active transaction when manul is interrupted.
+func handleInterrupts() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+
+		// concurrent workers must not touch index while it's restored
+		indexMutex.Lock()
+
+		// lock is never released, the command must not continue after
+		// rollback
+		activeTransaction.Lock()
+
+		tx := activeTransaction.transaction
+		if tx != nil && !tx.done {
+			logger.Warningf("interrupted, rolling back changes")
+
+			err := tx.rollback()
+			if err != nil {
+				logger.Error(karma.Format(err, "unable to roll back changes"))
+			}
+		}
+
+		os.Exit(1)
+	}()
+}
+
+func beginTransaction() (*transaction, error) {
+	tx := &transaction{
+		files: map[string][]byte{},
+		moved: map[string]string{},
+	}
+
+	var err error
+
+	tx.index, err = getGitPath("index")
+	if err != nil {
+		return nil, err
+	}
+
+	tx.config, err = getGitPath("config")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range []string{
+		tx.index,
+		tx.config,
+		getGitmodulesPath(),
+		filepath.Join(workdir, vendorModulesFile),
+		filepath.Join(workdir, "go.mod"),
+		filepath.Join(workdir, "go.sum"),
+	} {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, karma.Format(err, "unable to read %s", path)
+		}
+
+		tx.files[path] = contents
+	}
+
+	statuses, err := getVendorSubmodulesStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	tx.submodules = map[string]string{}
+	for importpath, status := range statuses {
+		if status.State != '-' {
+			tx.submodules[importpath] = status.Commit
+		}
+	}
+
+	return tx, nil
+}
+
+// getGitPath returns absolute path of given file in git directory of main
+// repository.
+func getGitPath(name string) (string, error) {
+	output, err := executeStdout(
+		exec.Command("git", "rev-parse", "--git-path", name),
+	)
+	if err != nil {
+		return "", karma.Format(err, "unable to get path of %s", name)
+	}
+
+	return filepath.Abs(strings.TrimSpace(output))
+}
+
+// trashModule moves git directory of removed submodule out of the way
+// instead of removing it, so it can be restored by rollback.
+func (tx *transaction) trashModule(path string) error {
+	if tx.trash == "" {
+		trash, err := ioutil.TempDir(
+			filepath.Join(toplevel, ".git"), "manul-trash-",
+		)
+		if err != nil {
+			return karma.Format(err, "unable to create trash directory")
+		}
+
+		tx.trash = trash
+	}
+
+	target := filepath.Join(tx.trash, fmt.Sprint(len(tx.moved)))
+
+	err := os.Rename(path, target)
+	if err != nil {
+		return karma.Format(err, "unable to move %s to trash", path)
+	}
+
+	tx.moved[path] = target
+
+	return nil
+}
+
+// commit removes git directories of removed submodules.
+func (tx *transaction) commit() error {
+	tx.done = true
+
+	if tx.trash == "" {
+		return nil
+	}
+
+	err := os.RemoveAll(tx.trash)
+	if err != nil {
+		return karma.Format(err, "unable to remove %s", tx.trash)
+	}
+
+	return nil
+}
+
+// rollback restores repository state from snapshot: new vendor submodules
+// are removed, removed ones are restored and others are checked out at
+// previous commits. It must be called under activeTransaction lock, the
+// second call does nothing.
+func (tx *transaction) rollback() error {
+	if tx.done {
+		return nil
+	}
+
+	tx.done = true
+
+	var (
+		gitmodulesChanged = false
+		errs              []error
+	)
+
+	for path, contents := range tx.files {
+		current, err := ioutil.ReadFile(path)
+		if err == nil && contents != nil && bytes.Equal(current, contents) {
+			continue
+		}
+
+		if path == getGitmodulesPath() {
+			gitmodulesChanged = true
+		}
+
+		err = restoreFile(path, contents)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for path, trashed := range tx.moved {
+		err := os.Rename(trashed, path)
+		if err != nil {
+			errs = append(errs, karma.Format(err, "unable to restore %s", path))
+		}
+	}
+
+	err := tx.removeCreatedDirs()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(tx.moved) > 0 {
+		_, err := execute(
+			exec.Command("git", "submodule", "update", "--init", "--", vendorDir),
+		)
+		if err != nil {
+			errs = append(errs, karma.Format(
+				err, "unable to check out restored submodules",
+			))
+		}
+	}
+
+	if gitmodulesChanged {
+		_, err := execute(
+			exec.Command("git", "submodule", "sync", "--", vendorDir),
+		)
+		if err != nil {
+			errs = append(errs, karma.Format(
+				err, "unable to restore URLs of submodules",
+			))
+		}
+	}
+
+	for importpath, commit := range tx.submodules {
+		err := restoreSubmoduleCommit(importpath, commit)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if tx.trash != "" {
+		os.RemoveAll(tx.trash)
+	}
+
+	if len(errs) > 0 {
+		return karma.Push(
+			fmt.Errorf("rollback is incomplete"),
+			errorsToReasons(errs)...,
+		)
+	}
+
+	logger.Infof("changes are rolled back")
+
+	return nil
+}
+
+// createdDir is a directory of import path in root directory, like vendor
+// directory or .git/modules.
+type createdDir struct {
+	Root       string
+	Importpath string
+}
+
+// recordCreatedDir remembers that directory of given import path in root
+// directory is going to be created by active transaction, so it's removed
+// on rollback. Directories which already exist belong to user and are not
+// recorded.
+func recordCreatedDir(root string, importpath string) {
+	_, err := os.Lstat(filepath.Join(root, importpath))
+	if !os.IsNotExist(err) {
+		return
+	}
+
+	activeTransaction.Lock()
+	defer activeTransaction.Unlock()
+
+	tx := activeTransaction.transaction
+	if tx != nil {
+		tx.created = append(tx.created, createdDir{
+			Root:       root,
+			Importpath: importpath,
+		})
+	}
+}
+
+// removeCreatedDirs removes vendor submodules and git directories which
+// were created during transaction.
+func (tx *transaction) removeCreatedDirs() error {
+	for _, dir := range tx.created {
+		path := filepath.Join(dir.Root, dir.Importpath)
+
+		logger.Debugf("removing %s created by failed command", path)
+
+		err := os.RemoveAll(path)
+		if err != nil {
+			return karma.Format(err, "unable to remove %s", path)
+		}
+
+		removeEmptyParents(dir.Root, dir.Importpath)
+	}
+
+	return nil
+}
+
+// removeEmptyParents removes parent directories like github.com/owner which
+// were created for removed submodule, directories which contain other
+// submodules are not empty, so they are kept.
+func removeEmptyParents(root string, importpath string) {
+	for dir := filepath.Dir(importpath); dir != "."; dir = filepath.Dir(dir) {
+		if os.Remove(filepath.Join(root, dir)) != nil {
+			break
+		}
+	}
+}
+
+// restoreSubmoduleCommit checks out given commit in vendor submodule if
+// another commit is checked out.
+func restoreSubmoduleCommit(importpath string, commit string) error {
+	cwd := filepath.Join(workdir, getVendorPath(importpath))
+
+	output, err := execute(exec.Command("git", "-C", cwd, "rev-parse", "HEAD"))
+	if err == nil && strings.TrimSpace(output) == commit {
+		return nil
+	}
+
+	_, err = execute(exec.Command("git", "-C", cwd, "checkout", "-q", commit))
+	if err != nil {
+		return karma.Format(
+			err, "unable to check out %s in %s", commit, importpath,
+		)
+	}
+
+	return nil
+}
+
+// restoreFile atomically replaces file with given contents, nil contents
+// means that file must not exist.
+func restoreFile(path string, contents []byte) error {
+	if contents == nil {
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return karma.Format(err, "unable to remove %s", path)
+		}
+
+		return nil
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(path), ".manul-")
+	if err != nil {
+		return karma.Format(err, "unable to restore %s", path)
+	}
+
+	_, err = temp.Write(contents)
+	if err == nil {
+		err = temp.Close()
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return karma.Format(err, "unable to restore %s", path)
+	}
+
+	return nil
+}
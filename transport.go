@@ -0,0 +1,297 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/reconquest/karma-go"
+)
+
+// transportOptions describes how manul and git connect to remote servers.
+type transportOptions struct {
+	// CAFile is a PEM file with certificates which are trusted in addition
+	// to system ones.
+	CAFile string
+
+	// ClientCert and ClientKey are PEM files with client certificate and
+	// its private key.
+	ClientCert string
+	ClientKey  string
+
+	// Proxy is URL of HTTP proxy, proxy from environment variables is used
+	// if it's empty.
+	Proxy string
+
+	// Insecure is a list of hosts which certificates are not verified,
+	// "*" disables verification for all hosts.
+	Insecure []string
+}
+
+// configureTransport configures http.DefaultClient which is used for
+// requesting go-import meta and module proxies, and passes the same settings
+// to git commands using GIT_CONFIG_* environment variables.
+func configureTransport(options transportOptions) error {
+	var err error
+
+	for _, path := range []*string{
+		&options.CAFile, &options.ClientCert, &options.ClientKey,
+	} {
+		if *path == "" {
+			continue
+		}
+
+		// git is run in submodule directories too, so paths must not be
+		// relative.
+		*path, err = filepath.Abs(*path)
+		if err != nil {
+			return karma.Format(err, "unable to get absolute path of %s", *path)
+		}
+	}
+
+	config, err := getTLSConfig(options)
+	if err != nil {
+		return err
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if options.Proxy != "" {
+		proxyURL, err := url.Parse(options.Proxy)
+		if err != nil {
+			return karma.Format(err, "invalid proxy URL: %s", options.Proxy)
+		}
+
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	// default transport has timeouts and HTTP/2 enabled, they must be kept
+	secure := http.DefaultTransport.(*http.Transport).Clone()
+	secure.Proxy = proxy
+	secure.TLSClientConfig = config
+
+	if len(options.Insecure) == 0 {
+		http.DefaultClient.Transport = secure
+	} else {
+		insecure := secure.Clone()
+		insecure.TLSClientConfig.InsecureSkipVerify = true
+
+		http.DefaultClient.Transport = &hostTransport{
+			secure:   secure,
+			insecure: insecure,
+			hosts:    options.Insecure,
+		}
+	}
+
+	return setGitConfigEnv(getGitTransportConfig(options))
+}
+
+func getTLSConfig(options transportOptions) (*tls.Config, error) {
+	config := &tls.Config{}
+
+	if options.CAFile != "" {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+
+		pem, err := ioutil.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, karma.Format(
+				err, "unable to read CA file %s", options.CAFile,
+			)
+		}
+
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf(
+				"no certificates found in CA file %s", options.CAFile,
+			)
+		}
+
+		config.RootCAs = roots
+	}
+
+	if options.ClientCert != "" || options.ClientKey != "" {
+		key := options.ClientKey
+		if key == "" {
+			// key can be stored in the same file as certificate
+			key = options.ClientCert
+		}
+
+		certificate, err := tls.LoadX509KeyPair(options.ClientCert, key)
+		if err != nil {
+			return nil, karma.Format(
+				err, "unable to load client certificate %s", options.ClientCert,
+			)
+		}
+
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
+
+// hostTransport uses insecure transport for hosts from insecure list,
+// tls.Config can disable verification only for all hosts at once.
+type hostTransport struct {
+	secure   http.RoundTripper
+	insecure http.RoundTripper
+	hosts    []string
+}
+
+func (transport *hostTransport) RoundTrip(
+	request *http.Request,
+) (*http.Response, error) {
+	if isInsecureHost(transport.hosts, request.URL.Hostname()) {
+		return transport.insecure.RoundTrip(request)
+	}
+
+	return transport.secure.RoundTrip(request)
+}
+
+func isInsecureHost(insecure []string, host string) bool {
+	for _, item := range insecure {
+		if item == "*" || item == host {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getGitTransportConfig returns git config variables which make git use the
+// same transport settings as manul.
+func getGitTransportConfig(options transportOptions) [][2]string {
+	var config [][2]string
+
+	if options.CAFile != "" {
+		config = append(config, [2]string{"http.sslCAInfo", options.CAFile})
+	}
+
+	if options.ClientCert != "" {
+		config = append(config, [2]string{"http.sslCert", options.ClientCert})
+	}
+
+	if options.ClientKey != "" {
+		config = append(config, [2]string{"http.sslKey", options.ClientKey})
+	}
+
+	if options.Proxy != "" {
+		config = append(config, [2]string{"http.proxy", options.Proxy})
+	}
+
+	for _, host := range options.Insecure {
+		key := "http.sslVerify"
+		if host != "*" {
+			key = "http.https://" + host + "/.sslVerify"
+		}
+
+		config = append(config, [2]string{key, "false"})
+	}
+
+	return config
+}
+
+// setGitConfigEnv passes config variables to all git commands run by manul,
+// variables passed by user in the same way are kept. GIT_CONFIG_COUNT is
+// supported since git 2.31, older versions get variables through
+// GIT_CONFIG_PARAMETERS which is used by git -c.
+func setGitConfigEnv(config [][2]string) error {
+	if len(config) == 0 {
+		return nil
+	}
+
+	major, minor, err := getGitVersion()
+	if err != nil {
+		return err
+	}
+
+	if major < 2 || major == 2 && minor < 31 {
+		return setGitConfigParameters(config)
+	}
+
+	count := 0
+	if value := os.Getenv("GIT_CONFIG_COUNT"); value != "" {
+		count, err = strconv.Atoi(value)
+		if err != nil {
+			return karma.Format(err, "invalid GIT_CONFIG_COUNT: %s", value)
+		}
+	}
+
+	for _, variable := range config {
+		index := strconv.Itoa(count)
+
+		err := os.Setenv("GIT_CONFIG_KEY_"+index, variable[0])
+		if err != nil {
+			return err
+		}
+
+		err = os.Setenv("GIT_CONFIG_VALUE_"+index, variable[1])
+		if err != nil {
+			return err
+		}
+
+		count++
+	}
+
+	return os.Setenv("GIT_CONFIG_COUNT", strconv.Itoa(count))
+}
+
+// setGitConfigParameters appends config variables to GIT_CONFIG_PARAMETERS
+// in 'key=value' format which is understood by all git versions.
+func setGitConfigParameters(config [][2]string) error {
+	parameters := []string{}
+	if value := os.Getenv("GIT_CONFIG_PARAMETERS"); value != "" {
+		parameters = append(parameters, value)
+	}
+
+	for _, variable := range config {
+		parameter := variable[0] + "=" + variable[1]
+
+		parameters = append(
+			parameters,
+			"'"+strings.Replace(parameter, "'", `'\''`, -1)+"'",
+		)
+	}
+
+	return os.Setenv("GIT_CONFIG_PARAMETERS", strings.Join(parameters, " "))
+}
+
+// getGitVersion returns major and minor version of installed git, output of
+// git --version looks like "git version 2.39.5" with optional suffixes like
+// ".windows.1" or " (Apple Git-143)".
+func getGitVersion() (int, int, error) {
+	output, err := executeStdout(exec.Command("git", "--version"))
+	if err != nil {
+		return 0, 0, karma.Format(err, "unable to get git version")
+	}
+
+	fields := strings.Fields(output)
+	if len(fields) < 3 {
+		return 0, 0, fmt.Errorf("unexpected git version: %s", output)
+	}
+
+	parts := strings.SplitN(fields[2], ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("unexpected git version: %s", output)
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected git version: %s", output)
+	}
+
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected git version: %s", output)
+	}
+
+	return major, minor, nil
+}
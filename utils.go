@@ -1,8 +1,13 @@
 package main
 
 import (
+	"fmt"
 	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
 
+	"github.com/reconquest/karma-go"
 	"github.com/reconquest/lexec-go"
 )
 
@@ -16,6 +21,53 @@ func execute(cmd *exec.Cmd) (string, error) {
 	return string(stdout) + string(stderr), err
 }
 
+// executeStdout works like execute, but returns only standard output of
+// command, so it can be decoded.
+func executeStdout(cmd *exec.Cmd) (string, error) {
+	if verbose {
+		logger.Debugf("%s", cmd.Args)
+	}
+
+	execution := lexec.NewExec(lexec.Loggerf(logger.Tracef), cmd)
+	stdout, _, err := execution.Output()
+	return string(stdout), err
+}
+
+// executeChange works like execute, but is used for commands which modify
+// repository, in dry-run mode command is only printed.
+func executeChange(cmd *exec.Cmd) (string, error) {
+	if dryRun {
+		fmt.Println(formatCommand(cmd))
+		return "", nil
+	}
+
+	return execute(cmd)
+}
+
+func formatCommand(cmd *exec.Cmd) string {
+	args := make([]string, len(cmd.Args))
+	for i, arg := range cmd.Args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$`*?[]{}()<>|&;#~") {
+			arg = strconv.Quote(arg)
+		}
+
+		args[i] = arg
+	}
+
+	return strings.Join(args, " ")
+}
+
+// errorsToReasons converts errors to reasons which can be pushed into
+// karma hierarchy.
+func errorsToReasons(errs []error) []karma.Reason {
+	reasons := make([]karma.Reason, len(errs))
+	for i, err := range errs {
+		reasons[i] = err
+	}
+
+	return reasons
+}
+
 func getMaxLength(elements []string) int {
 	maxlength := 0
 	for _, element := range elements {
@@ -36,3 +88,67 @@ func getKeys(items map[string]string) []string {
 
 	return keys
 }
+
+// runParallel calls given function for indexes from 0 to count using at most
+// jobs concurrent workers and returns errors by indexes. No new calls are
+// started after any call fails.
+func runParallel(jobs int, count int, fn func(index int) error) []error {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	var (
+		errs   = make([]error, count)
+		queue  = make(chan int)
+		failed = false
+		mutex  = sync.Mutex{}
+		group  = sync.WaitGroup{}
+	)
+
+	for worker := 0; worker < jobs && worker < count; worker++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+
+			for index := range queue {
+				err := fn(index)
+				if err != nil {
+					mutex.Lock()
+					errs[index] = err
+					failed = true
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+
+	for index := 0; index < count; index++ {
+		mutex.Lock()
+		stop := failed
+		mutex.Unlock()
+
+		if stop {
+			break
+		}
+
+		queue <- index
+	}
+
+	close(queue)
+	group.Wait()
+
+	return errs
+}
+
+// splitList splits comma-separated list, empty items are skipped.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+var vcsNames = map[string]string{
+	"hg":     "mercurial",
+	"svn":    "subversion",
+	"bzr":    "bazaar",
+	"fossil": "fossil",
+}
+
+// unsupportedVCSError is returned when go-import meta declares that
+// repository is managed by VCS other than git.
+type unsupportedVCSError struct {
+	Importpath string
+	VCS        string
+	URL        string
+}
+
+func (err *unsupportedVCSError) Error() string {
+	return fmt.Sprintf(
+		"%s is %s repository at %s, it can't be vendored as git submodule, "+
+			"use --convert to clone it using git-remote-%s",
+		err.Importpath, err.getName(), err.URL, err.VCS,
+	)
+}
+
+func (err *unsupportedVCSError) getName() string {
+	if name, ok := vcsNames[err.VCS]; ok {
+		return name
+	}
+
+	return err.VCS
+}
+
+// getRemoteHelperURL returns URL that can be cloned by git using remote
+// helper for VCS of repository, e.g. git-remote-hg for mercurial.
+func (err *unsupportedVCSError) getRemoteHelperURL() (string, error) {
+	helper := "git-remote-" + err.VCS
+
+	_, lookErr := exec.LookPath(helper)
+	if lookErr != nil {
+		return "", fmt.Errorf(
+			"%s is %s repository at %s, but %s is not found in PATH, "+
+				"it's required for converting repository into git",
+			err.Importpath, err.getName(), err.URL, helper,
+		)
+	}
+
+	return err.VCS + "::" + err.URL, nil
+}